@@ -2,6 +2,7 @@
 package bridge
 
 import (
+    "crypto/tls"
     "fmt"
     "github.com/go-stomp/stomp"
     "github.com/google/uuid"
@@ -32,11 +33,15 @@ func checkConfig(config *BrokerConnectorConfig) error {
     if config.ServerAddr == "" {
         return fmt.Errorf("config invalid, config missing server address")
     }
-    if config.Username == "" {
-        return fmt.Errorf("config invalid, config missing username")
-    }
-    if config.Password == "" {
-        return fmt.Errorf("config invalid, config missing password")
+    // a client certificate is commonly sufficient authentication on its own (mTLS), so
+    // username/password are only mandatory when one isn't configured.
+    if config.ClientCertFile == "" || config.ClientKeyFile == "" {
+        if config.Username == "" {
+            return fmt.Errorf("config invalid, config missing username")
+        }
+        if config.Password == "" {
+            return fmt.Errorf("config invalid, config missing password")
+        }
     }
     return nil
 }
@@ -48,6 +53,7 @@ func (bc *brokerConnector) Connect(config *BrokerConnectorConfig) (Connection, e
     if err != nil {
         return nil, err
     }
+    bc.config = config
 
     // use different mechanism for WS connections.
     if config.UseWS {
@@ -65,13 +71,31 @@ func (bc *brokerConnector) connectTCP(config *BrokerConnectorConfig, err error)
         stomp.ConnOpt.Login(config.Username, config.Password),
         stomp.ConnOpt.Host(config.HostHeader),
     }
-    conn, err := stomp.Dial("tcp", config.ServerAddr, options...)
-    if err != nil {
-        return nil, err
+
+    var conn *stomp.Conn
+    if config.UseTLS {
+        tlsConfig, err := buildTLSConfig(config)
+        if err != nil {
+            return nil, err
+        }
+        tlsConn, err := tls.Dial("tcp", config.ServerAddr, tlsConfig)
+        if err != nil {
+            return nil, err
+        }
+        conn, err = stomp.Connect(tlsConn, options...)
+        if err != nil {
+            return nil, err
+        }
+    } else {
+        conn, err = stomp.Dial("tcp", config.ServerAddr, options...)
+        if err != nil {
+            return nil, err
+        }
     }
     id := uuid.New()
     bcConn := &connection{
         id:             &id,
+        bc:             bc,
         conn:           conn,
         subscriptions:  make(map[string]Subscription),
         useWs:          false,
@@ -80,13 +104,29 @@ func (bc *brokerConnector) connectTCP(config *BrokerConnectorConfig, err error)
     bc.c = bcConn
     bc.connected = true
     bc.config = config
+
+    if config.ReconnectPolicy != nil {
+        go bcConn.superviseReconnects(config.ReconnectPolicy, config.StateChangeListener)
+    }
     return bcConn, nil
 }
 
 func (bc *brokerConnector) connectWs(config *BrokerConnectorConfig) (Connection, error) {
 
-    u := url.URL{Scheme: "ws", Host: config.ServerAddr, Path: config.WSPath}
-    c := NewBridgeWsClient()
+    scheme := "ws"
+    var c BridgeWsClient
+    if config.UseTLS {
+        scheme = "wss"
+        tlsConfig, err := buildTLSConfig(config)
+        if err != nil {
+            return nil, err
+        }
+        c = NewBridgeWsClientWithTLS(tlsConfig)
+    } else {
+        c = NewBridgeWsClient()
+    }
+
+    u := url.URL{Scheme: scheme, Host: config.ServerAddr, Path: config.WSPath}
     err := c.Connect(&u, nil)
     if err != nil {
         return nil, fmt.Errorf("cannot connect to host '%s' via path '%s', stopping", config.ServerAddr, config.WSPath)
@@ -94,6 +134,7 @@ func (bc *brokerConnector) connectWs(config *BrokerConnectorConfig) (Connection,
     id := uuid.New()
     bcConn := &connection{
         id:             &id,
+        bc:             bc,
         wsConn:         c,
         subscriptions:  make(map[string]Subscription),
         useWs:          true,
@@ -101,5 +142,9 @@ func (bc *brokerConnector) connectWs(config *BrokerConnectorConfig) (Connection,
         disconnectChan: make(chan bool)}
     bc.c = bcConn
     bc.connected = true
+
+    if config.ReconnectPolicy != nil {
+        go bcConn.superviseReconnects(config.ReconnectPolicy, config.StateChangeListener)
+    }
     return bcConn, nil
 }
\ No newline at end of file
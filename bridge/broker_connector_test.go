@@ -0,0 +1,119 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "bufio"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "math/big"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "github.com/stretchr/testify/assert"
+)
+
+// generateSelfSignedCert produces a throwaway self-signed certificate for 127.0.0.1, good for
+// exercising the TLS dial path without checking in a static cert.
+func generateSelfSignedCert(t *testing.T) tls.Certificate {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    assert.Nil(t, err)
+
+    template := x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject:      pkix.Name{CommonName: "127.0.0.1"},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    }
+
+    der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+    assert.Nil(t, err)
+
+    cert, err := x509.ParseCertificate(der)
+    assert.Nil(t, err)
+
+    return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+// serveStompConnectOnce accepts a single connection on ln, reads the CONNECT frame, and replies
+// with a bare-minimum CONNECTED frame so stomp.Connect on the other end succeeds.
+func serveStompConnectOnce(t *testing.T, ln net.Listener) {
+    go func() {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        reader := bufio.NewReader(conn)
+        for {
+            line, err := reader.ReadString('\n')
+            if err != nil {
+                return
+            }
+            if strings.TrimRight(line, "\r\n") == "" {
+                break
+            }
+        }
+        conn.Write([]byte("CONNECTED\nversion:1.2\n\n\x00"))
+    }()
+}
+
+func TestBrokerConnector_ConnectTCP_TLS(t *testing.T) {
+    cert := generateSelfSignedCert(t)
+
+    ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+    assert.Nil(t, err)
+    defer ln.Close()
+
+    serveStompConnectOnce(t, ln)
+
+    connector := NewBrokerConnector()
+    conn, err := connector.Connect(&BrokerConnectorConfig{
+        ServerAddr:         ln.Addr().String(),
+        Username:           "guest",
+        Password:           "guest",
+        UseTLS:             true,
+        InsecureSkipVerify: true,
+    })
+
+    assert.Nil(t, err)
+    assert.NotNil(t, conn)
+}
+
+func TestBrokerConnector_ConnectWs_WSS(t *testing.T) {
+    upgrader := websocket.Upgrader{}
+    server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        conn.Close()
+    }))
+    defer server.Close()
+
+    addr := strings.TrimPrefix(server.URL, "https://")
+
+    connector := NewBrokerConnector()
+    conn, err := connector.Connect(&BrokerConnectorConfig{
+        ServerAddr:         addr,
+        Username:           "guest",
+        Password:           "guest",
+        UseWS:              true,
+        UseTLS:             true,
+        InsecureSkipVerify: true,
+    })
+
+    assert.Nil(t, err)
+    assert.NotNil(t, conn)
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import "crypto/tls"
+
+// BrokerConnectorConfig configures how a BrokerConnector dials a message broker, over either a
+// raw TCP STOMP connection or a STOMP-over-WebSocket connection.
+type BrokerConnectorConfig struct {
+    Username   string
+    Password   string
+    ServerAddr string
+    UseWS      bool
+    WSPath     string
+    HostHeader string
+
+    // UseTLS dials the broker over TLS: tls.Dial for TCP, wss:// for WebSocket.
+    UseTLS bool
+
+    // TLSConfig, when set, is used as-is for the TLS handshake, taking precedence over
+    // ServerCAFile/ClientCertFile/ClientKeyFile/InsecureSkipVerify below.
+    TLSConfig *tls.Config
+
+    // ServerCAFile, when set, becomes the only certificate pool used to verify the broker's
+    // certificate; the system pool is not consulted.
+    ServerCAFile string
+
+    // ClientCertFile/ClientKeyFile, when both set, present a client certificate during the TLS
+    // handshake. Some STOMP servers authenticate via mTLS alone, so when a client cert is
+    // configured, Username/Password become optional.
+    ClientCertFile string
+    ClientKeyFile  string
+
+    // InsecureSkipVerify disables verification of the broker's certificate chain and host name.
+    // Only ever intended for local development against self-signed test brokers.
+    InsecureSkipVerify bool
+
+    // ReconnectPolicy, when set, makes the connection supervise itself: an unexpected link drop
+    // is retried with backoff instead of surfacing as a dead Connection.
+    ReconnectPolicy *ReconnectPolicy
+
+    // StateChangeListener, when set, is called with every lifecycle transition a supervised
+    // connection goes through (Connecting/Connected/Reconnecting/Disconnected/GaveUp).
+    StateChangeListener ConnectionStateListener
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "encoding/json"
+    "sync"
+
+    "github.com/go-stomp/stomp"
+    "github.com/google/uuid"
+
+    "go-bifrost/model"
+)
+
+// Subscription represents a single STOMP subscription made against a Connection.
+type Subscription interface {
+    GetId() string
+    GetDestination() string
+    GetMessageChannel() chan *model.Message
+    Unsubscribe() error
+}
+
+// Connection represents a single, live connection to a message broker, established by
+// BrokerConnector.Connect.
+type Connection interface {
+    Subscribe(destination string, ackMode stomp.AckMode) (Subscription, error)
+    SendJSONMessage(destination string, payload interface{}) error
+    Disconnect() error
+}
+
+type connection struct {
+    id             *uuid.UUID
+    bc             *brokerConnector
+    conn           *stomp.Conn
+    wsConn         BridgeWsClient
+    subscriptions  map[string]Subscription
+    useWs          bool
+    connLock       sync.Mutex
+    // disconnectChan carries unexpected-drop signals to superviseReconnects and is closed once by
+    // Disconnect. It is allocated exactly once per connection and never swapped out on redial, so
+    // the supervisor's range over it and Disconnect's close of it always agree on which channel
+    // that is.
+    disconnectChan chan bool
+
+    // reconnecting is set while a link drop is already being supervised, so concurrent
+    // subscription pumps reporting the same drop don't queue up duplicate reconnect attempts.
+    reconnecting bool
+    disconnectOnce sync.Once
+}
+
+type subscription struct {
+    id           string
+    destination  string
+    ackMode      stomp.AckMode
+    msgChan      chan *model.Message
+    stompSub     *stomp.Subscription
+    unsubscribed bool
+}
+
+func (s *subscription) GetId() string                         { return s.id }
+func (s *subscription) GetDestination() string                 { return s.destination }
+func (s *subscription) GetMessageChannel() chan *model.Message { return s.msgChan }
+
+func (s *subscription) Unsubscribe() error {
+    s.unsubscribed = true
+    if s.stompSub == nil {
+        return nil
+    }
+    return s.stompSub.Unsubscribe()
+}
+
+// pump copies messages off the underlying STOMP subscription channel until it closes, either
+// because Unsubscribe was called or because the broker link dropped out from under it. An
+// unexpected close is reported to the parent connection so it can be supervised for reconnect.
+func (s *subscription) pump(c *connection) {
+    for msg := range s.stompSub.C {
+        if msg == nil || msg.Err != nil {
+            continue
+        }
+        s.msgChan <- &model.Message{Channel: s.destination, Payload: msg.Body}
+    }
+    if !s.unsubscribed {
+        c.signalUnexpectedDisconnect()
+    }
+}
+
+func (c *connection) Subscribe(destination string, ackMode stomp.AckMode) (Subscription, error) {
+    c.connLock.Lock()
+    defer c.connLock.Unlock()
+
+    id := uuid.New().String()
+    sub := &subscription{id: id, destination: destination, ackMode: ackMode, msgChan: make(chan *model.Message, 100)}
+
+    if !c.useWs {
+        stompSub, err := c.conn.Subscribe(destination, ackMode)
+        if err != nil {
+            return nil, err
+        }
+        sub.stompSub = stompSub
+        go sub.pump(c)
+    }
+
+    c.subscriptions[id] = sub
+    return sub, nil
+}
+
+func (c *connection) SendJSONMessage(destination string, payload interface{}) error {
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    c.connLock.Lock()
+    defer c.connLock.Unlock()
+
+    if c.useWs {
+        return nil
+    }
+    return c.conn.Send(destination, "application/json", body)
+}
+
+// signalUnexpectedDisconnect notifies the reconnect supervisor of a link drop at most once per
+// outage: further reports while a reconnect attempt is already underway are ignored.
+func (c *connection) signalUnexpectedDisconnect() {
+    c.connLock.Lock()
+    if c.reconnecting {
+        c.connLock.Unlock()
+        return
+    }
+    c.reconnecting = true
+    c.connLock.Unlock()
+
+    select {
+    case c.disconnectChan <- true:
+    default:
+    }
+}
+
+func (c *connection) Disconnect() error {
+    c.connLock.Lock()
+    for _, s := range c.subscriptions {
+        s.(*subscription).unsubscribed = true
+    }
+    c.connLock.Unlock()
+
+    c.disconnectOnce.Do(func() {
+        close(c.disconnectChan)
+    })
+
+    c.connLock.Lock()
+    defer c.connLock.Unlock()
+
+    if c.useWs {
+        return c.wsConn.Disconnect()
+    }
+    return c.conn.Disconnect()
+}
+
+// resubscribeAll re-issues every preserved subscription's destination and ack mode against the
+// freshly redialed broker connection, so consumers reading from the same message channels keep
+// receiving without rebuilding anything.
+func (c *connection) resubscribeAll() {
+    c.connLock.Lock()
+    subs := make([]*subscription, 0, len(c.subscriptions))
+    for _, s := range c.subscriptions {
+        subs = append(subs, s.(*subscription))
+    }
+    conn := c.conn
+    useWs := c.useWs
+    c.connLock.Unlock()
+
+    if useWs {
+        return
+    }
+
+    for _, s := range subs {
+        stompSub, err := conn.Subscribe(s.destination, s.ackMode)
+        if err != nil {
+            continue
+        }
+        s.stompSub = stompSub
+        s.unsubscribed = false
+        go s.pump(c)
+    }
+}
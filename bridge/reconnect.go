@@ -0,0 +1,173 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "crypto/tls"
+    "math/rand"
+    "net/url"
+    "time"
+
+    "github.com/go-stomp/stomp"
+)
+
+// ConnectionState describes a supervised connection's position in its reconnect lifecycle.
+type ConnectionState int
+
+const (
+    StateConnecting ConnectionState = iota
+    StateConnected
+    StateReconnecting
+    StateDisconnected
+    StateGaveUp
+)
+
+// ConnectionStateListener is notified of every lifecycle transition a supervised connection
+// goes through, so callers (e.g. EventBus) can mark affected galactic channels as degraded.
+type ConnectionStateListener func(state ConnectionState)
+
+// ReconnectPolicy controls the exponential backoff a connection uses to re-establish a broker
+// link it lost unexpectedly.
+type ReconnectPolicy struct {
+    MaxAttempts  int           // 0 means retry forever.
+    InitialDelay time.Duration
+    MaxDelay     time.Duration
+    Multiplier   float64
+    Jitter       float64 // fraction (0..1) of the computed delay to randomize, +/-.
+}
+
+func (p *ReconnectPolicy) delayFor(attempt int) time.Duration {
+    multiplier := p.Multiplier
+    if multiplier <= 0 {
+        multiplier = 1
+    }
+    delay := float64(p.InitialDelay)
+    for i := 0; i < attempt; i++ {
+        delay *= multiplier
+    }
+    if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+        delay = float64(p.MaxDelay)
+    }
+    if p.Jitter > 0 {
+        delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+    }
+    if delay < 0 {
+        delay = 0
+    }
+    return time.Duration(delay)
+}
+
+func notifyState(listener ConnectionStateListener, state ConnectionState) {
+    if listener != nil {
+        listener(state)
+    }
+}
+
+// superviseReconnects watches c.disconnectChan for an unexpected link drop and redials with
+// backoff, re-issuing every subscription preserved on c so consumers keep receiving without
+// rebuilding anything. It returns once c.disconnectChan is closed by an intentional Disconnect.
+func (c *connection) superviseReconnects(policy *ReconnectPolicy, listener ConnectionStateListener) {
+    for unexpected := range c.disconnectChan {
+        if !unexpected {
+            continue
+        }
+
+        notifyState(listener, StateReconnecting)
+
+        attempt := 0
+        for {
+            if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+                notifyState(listener, StateGaveUp)
+                break
+            }
+            if attempt > 0 {
+                time.Sleep(policy.delayFor(attempt - 1))
+            }
+            attempt++
+
+            notifyState(listener, StateConnecting)
+
+            var err error
+            if c.useWs {
+                err = c.bc.redialWs(c)
+            } else {
+                err = c.bc.redialTCP(c)
+            }
+            if err != nil {
+                continue
+            }
+
+            notifyState(listener, StateConnected)
+            c.resubscribeAll()
+            break
+        }
+
+        c.connLock.Lock()
+        c.reconnecting = false
+        c.connLock.Unlock()
+    }
+    notifyState(listener, StateDisconnected)
+}
+
+// redialTCP re-dials config.ServerAddr over TCP (optionally TLS) and swaps the result into c in
+// place, so Subscription handles callers already hold stay valid across the reconnect.
+func (bc *brokerConnector) redialTCP(c *connection) error {
+    config := bc.config
+    options := []func(*stomp.Conn) error{
+        stomp.ConnOpt.Login(config.Username, config.Password),
+        stomp.ConnOpt.Host(config.HostHeader),
+    }
+
+    var conn *stomp.Conn
+    var err error
+    if config.UseTLS {
+        var tlsConfig *tls.Config
+        tlsConfig, err = buildTLSConfig(config)
+        if err != nil {
+            return err
+        }
+        rawConn, dialErr := tls.Dial("tcp", config.ServerAddr, tlsConfig)
+        if dialErr != nil {
+            return dialErr
+        }
+        conn, err = stomp.Connect(rawConn, options...)
+    } else {
+        conn, err = stomp.Dial("tcp", config.ServerAddr, options...)
+    }
+    if err != nil {
+        return err
+    }
+
+    c.connLock.Lock()
+    c.conn = conn
+    c.connLock.Unlock()
+    return nil
+}
+
+// redialWs re-dials config.ServerAddr over WebSocket (optionally WSS) and swaps the result into
+// c in place.
+func (bc *brokerConnector) redialWs(c *connection) error {
+    config := bc.config
+
+    scheme := "ws"
+    var wsClient BridgeWsClient
+    if config.UseTLS {
+        scheme = "wss"
+        tlsConfig, err := buildTLSConfig(config)
+        if err != nil {
+            return err
+        }
+        wsClient = NewBridgeWsClientWithTLS(tlsConfig)
+    } else {
+        wsClient = NewBridgeWsClient()
+    }
+
+    u := url.URL{Scheme: scheme, Host: config.ServerAddr, Path: config.WSPath}
+    if err := wsClient.Connect(&u, nil); err != nil {
+        return err
+    }
+
+    c.connLock.Lock()
+    c.wsConn = wsClient
+    c.connLock.Unlock()
+    return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+// fakeStompServer is a minimal hand-rolled STOMP server: enough to CONNECT, accept a SUBSCRIBE,
+// and push a MESSAGE frame to a subscription id, so reconnect_test can simulate a broker that
+// drops a connection mid-stream and assert the client recovers.
+type fakeStompServer struct {
+    ln   net.Listener
+    lock sync.Mutex
+    conn net.Conn
+    subs map[string]string // subscription id -> destination
+}
+
+func newFakeStompServer(t *testing.T) *fakeStompServer {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    assert.Nil(t, err)
+    return &fakeStompServer{ln: ln, subs: make(map[string]string)}
+}
+
+func (f *fakeStompServer) addr() string {
+    return f.ln.Addr().String()
+}
+
+// acceptOne serves a single connection's frames until it closes or killConn drops it. subs is
+// reset on every accept so a resubscribe after reconnect can't be confused with the stale
+// subscription id the prior connection left behind.
+func (f *fakeStompServer) acceptOne(t *testing.T) net.Conn {
+    conn, err := f.ln.Accept()
+    assert.Nil(t, err)
+
+    f.lock.Lock()
+    f.conn = conn
+    f.subs = make(map[string]string)
+    f.lock.Unlock()
+
+    go f.serve(conn)
+    return conn
+}
+
+// acceptOneAsync backgrounds acceptOne, returning a channel that receives the accepted
+// connection. Use this instead of a bare acceptOne whenever the dial side (connector.Connect)
+// runs on the test goroutine and must run concurrently with the accept rather than after it,
+// since Connect blocks synchronously until CONNECTED is written back. A redial by the reconnect
+// supervisor already runs on its own goroutine, so a bare acceptOne serves it.
+func (f *fakeStompServer) acceptOneAsync(t *testing.T) <-chan net.Conn {
+    ch := make(chan net.Conn, 1)
+    go func() {
+        ch <- f.acceptOne(t)
+    }()
+    return ch
+}
+
+func (f *fakeStompServer) serve(conn net.Conn) {
+    reader := bufio.NewReader(conn)
+    for {
+        frame, err := readFrame(reader)
+        if err != nil {
+            return
+        }
+        switch frame.command {
+        case "CONNECT", "STOMP":
+            conn.Write([]byte("CONNECTED\nversion:1.2\n\n\x00"))
+        case "SUBSCRIBE":
+            f.lock.Lock()
+            f.subs[frame.headers["id"]] = frame.headers["destination"]
+            f.lock.Unlock()
+        }
+    }
+}
+
+// sendMessage pushes a MESSAGE frame for subId on whatever connection is currently being served.
+func (f *fakeStompServer) sendMessage(subId, destination, body string) {
+    f.lock.Lock()
+    conn := f.conn
+    f.lock.Unlock()
+    if conn == nil {
+        return
+    }
+    frame := fmt.Sprintf("MESSAGE\nsubscription:%s\nmessage-id:1\ndestination:%s\ncontent-length:%d\n\n%s\x00",
+        subId, destination, len(body), body)
+    conn.Write([]byte(frame))
+}
+
+type fakeFrame struct {
+    command string
+    headers map[string]string
+}
+
+func readFrame(reader *bufio.Reader) (*fakeFrame, error) {
+    line, err := reader.ReadString('\n')
+    if err != nil {
+        return nil, err
+    }
+    command := strings.TrimRight(line, "\r\n")
+    if command == "" {
+        return readFrame(reader) // skip stray heartbeat newlines
+    }
+
+    headers := make(map[string]string)
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        trimmed := strings.TrimRight(line, "\r\n")
+        if trimmed == "" {
+            break
+        }
+        parts := strings.SplitN(trimmed, ":", 2)
+        if len(parts) == 2 {
+            headers[parts[0]] = parts[1]
+        }
+    }
+    // consume the body up to the null terminator; this test never sends a body on client frames.
+    if _, err := reader.ReadString(0); err != nil {
+        return nil, err
+    }
+    return &fakeFrame{command: command, headers: headers}, nil
+}
+
+func TestConnection_ReconnectsAndResubscribes(t *testing.T) {
+    server := newFakeStompServer(t)
+
+    var states []ConnectionState
+    var statesLock sync.Mutex
+    listener := func(state ConnectionState) {
+        statesLock.Lock()
+        states = append(states, state)
+        statesLock.Unlock()
+    }
+
+    firstConnCh := server.acceptOneAsync(t)
+
+    connector := NewBrokerConnector()
+    conn, err := connector.Connect(&BrokerConnectorConfig{
+        ServerAddr: server.addr(),
+        Username:   "guest",
+        Password:   "guest",
+        ReconnectPolicy: &ReconnectPolicy{
+            MaxAttempts:  5,
+            InitialDelay: 10 * time.Millisecond,
+            MaxDelay:     50 * time.Millisecond,
+            Multiplier:   2,
+        },
+        StateChangeListener: listener,
+    })
+    assert.Nil(t, err)
+
+    firstConn := <-firstConnCh
+
+    sub, err := conn.Subscribe("/queue/test", 0)
+    assert.Nil(t, err)
+    originalSubId := sub.GetId()
+
+    // give the server a moment to record the SUBSCRIBE before killing the connection.
+    time.Sleep(20 * time.Millisecond)
+    firstConn.Close()
+
+    // the reconnect supervisor should redial and hit the listener again.
+    server.acceptOne(t)
+    time.Sleep(100 * time.Millisecond)
+
+    var subId string
+    server.lock.Lock()
+    for id, dest := range server.subs {
+        if dest == "/queue/test" {
+            subId = id
+        }
+    }
+    server.lock.Unlock()
+    assert.NotEmpty(t, subId)
+    assert.Equal(t, originalSubId, sub.GetId())
+
+    server.sendMessage(subId, "/queue/test", "hello-after-reconnect")
+
+    select {
+    case msg := <-sub.GetMessageChannel():
+        assert.Equal(t, string(msg.Payload.([]byte)), "hello-after-reconnect")
+    case <-time.After(time.Second):
+        assert.Fail(t, "timed out waiting for message to resume after reconnect")
+    }
+
+    statesLock.Lock()
+    assert.Contains(t, states, StateReconnecting)
+    assert.Contains(t, states, StateConnected)
+    statesLock.Unlock()
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "io/ioutil"
+)
+
+// buildTLSConfig resolves the *tls.Config a connection should use, honoring an explicit
+// TLSConfig override first, then ServerCAFile/ClientCertFile/ClientKeyFile/InsecureSkipVerify.
+func buildTLSConfig(config *BrokerConnectorConfig) (*tls.Config, error) {
+    if config.TLSConfig != nil {
+        return config.TLSConfig, nil
+    }
+
+    tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+    if config.ServerCAFile != "" {
+        caCert, err := ioutil.ReadFile(config.ServerCAFile)
+        if err != nil {
+            return nil, fmt.Errorf("cannot read server CA file '%s': %v", config.ServerCAFile, err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(caCert) {
+            return nil, fmt.Errorf("no certificates found in server CA file '%s'", config.ServerCAFile)
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    if config.ClientCertFile != "" && config.ClientKeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("cannot load client certificate/key pair: %v", err)
+        }
+        tlsConfig.Certificates = []tls.Certificate{cert}
+    }
+
+    return tlsConfig, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 VMware Inc.
+package bridge
+
+import (
+    "crypto/tls"
+    "net/http"
+    "net/url"
+
+    "github.com/gorilla/websocket"
+)
+
+// BridgeWsClient wraps a STOMP-over-WebSocket connection, abstracting the underlying websocket
+// library from the rest of the bridge package.
+type BridgeWsClient interface {
+    Connect(u *url.URL, headers http.Header) error
+    Disconnect() error
+}
+
+type bridgeWsClient struct {
+    dialer *websocket.Dialer
+    conn   *websocket.Conn
+}
+
+// NewBridgeWsClient creates a BridgeWsClient that dials with the default websocket.Dialer.
+func NewBridgeWsClient() BridgeWsClient {
+    return &bridgeWsClient{dialer: websocket.DefaultDialer}
+}
+
+// NewBridgeWsClientWithTLS creates a BridgeWsClient that dials wss:// using tlsConfig for the
+// handshake, so a custom CA, client certificate, or InsecureSkipVerify can be honored.
+func NewBridgeWsClientWithTLS(tlsConfig *tls.Config) BridgeWsClient {
+    dialer := *websocket.DefaultDialer
+    dialer.TLSClientConfig = tlsConfig
+    return &bridgeWsClient{dialer: &dialer}
+}
+
+func (c *bridgeWsClient) Connect(u *url.URL, headers http.Header) error {
+    conn, _, err := c.dialer.Dial(u.String(), headers)
+    if err != nil {
+        return err
+    }
+    c.conn = conn
+    return nil
+}
+
+func (c *bridgeWsClient) Disconnect() error {
+    if c.conn == nil {
+        return nil
+    }
+    return c.conn.Close()
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+// Authorizer is an optional, pluggable authorization hook consulted by a fabric endpoint before
+// honoring a client's CONNECT, SUBSCRIBE, or application request. It is given the raw STOMP
+// CONNECT headers captured for the connection (login/passcode, a custom Authorization bearer
+// token, ...) so JWT/OAuth validation and per-channel ACLs can be layered on without patching
+// the endpoint itself.
+type Authorizer interface {
+    // CanConnect is consulted once per connection, with the headers presented on the CONNECT
+    // frame. A non-nil error rejects the connection.
+    CanConnect(conId string, headers map[string]string) error
+
+    // CanSubscribe is consulted for every SUBSCRIBE frame. Returning false rejects the
+    // subscription: chanMappings is left untouched and an error frame is sent back to conId.
+    CanSubscribe(conId string, destination string, headers map[string]string) bool
+
+    // CanPublish is consulted for every application request. Returning false drops the request
+    // before it is ever dispatched onto the bus.
+    CanPublish(conId string, destination string, payload []byte) bool
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+import "sync"
+
+// durableEntry is one retained message in a durableStore's per-channel ring.
+type durableEntry struct {
+    seq  uint64
+    body []byte
+}
+
+// durableStore is a bounded, per-channel ring of published message bodies keyed by a
+// monotonically-increasing sequence number, backing EndpointConfig.DurableChannels. It mirrors
+// the durable-topic / message-store approach of the existing BusStore subsystem so a STOMP
+// subscriber that reconnects mid-stream can replay everything it missed.
+type durableStore struct {
+    capacity int
+    lock     sync.Mutex
+    seq      map[string]uint64
+    ring     map[string][]durableEntry
+}
+
+// newDurableStore creates a durableStore retaining up to capacity messages per channel.
+// capacity <= 0 falls back to a sane default.
+func newDurableStore(capacity int) *durableStore {
+    if capacity <= 0 {
+        capacity = 1000
+    }
+    return &durableStore{
+        capacity: capacity,
+        seq:      make(map[string]uint64),
+        ring:     make(map[string][]durableEntry),
+    }
+}
+
+// append records body as the next sequence for channelName, evicting the oldest entry once the
+// ring is at capacity, and returns the sequence it was assigned.
+func (d *durableStore) append(channelName string, body []byte) uint64 {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    d.seq[channelName]++
+    seq := d.seq[channelName]
+
+    entries := append(d.ring[channelName], durableEntry{seq: seq, body: body})
+    if len(entries) > d.capacity {
+        entries = entries[len(entries)-d.capacity:]
+    }
+    d.ring[channelName] = entries
+    return seq
+}
+
+// after returns every retained entry for channelName with a sequence greater than fromSeq, in
+// ascending sequence order. Entries evicted by the ring are simply not returned.
+func (d *durableStore) after(channelName string, fromSeq uint64) []durableEntry {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    var result []durableEntry
+    for _, e := range d.ring[channelName] {
+        if e.seq > fromSeq {
+            result = append(result, e)
+        }
+    }
+    return result
+}
+
+// lastSeq returns the most recent sequence number assigned for channelName, or 0 if nothing has
+// been published yet.
+func (d *durableStore) lastSeq(channelName string) uint64 {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return d.seq[channelName]
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+import (
+    "go-bifrost/mqttserver"
+)
+
+// EndpointType selects which transport StartFabricEndpoint exposes EventBus channels over. Both
+// endpoint types can be started against the same bus concurrently, so a STOMP client and an MQTT
+// client can talk over one shared channel.
+type EndpointType int
+
+const (
+    StompEndpoint EndpointType = iota
+    MqttEndpoint
+)
+
+// StartFabricEndpoint constructs the FabricEndpoint for endpointType against bus, dispatching to
+// the STOMP or MQTT bridge implementation and configuring it to listen on config.Addr. The
+// caller is still responsible for calling Start on the result, same as newFabricEndpoint and
+// newMqttEndpoint. This is the package's public entry point for exposing EventBus channels over
+// a network transport; a concrete EventBus implementation's own startup path is expected to call
+// it directly.
+func StartFabricEndpoint(bus EventBus, endpointType EndpointType, config EndpointConfig, retained RetainedMessageStore) FabricEndpoint {
+    switch endpointType {
+    case MqttEndpoint:
+        broker := mqttserver.NewMqttBroker(config.Addr, config.Heartbeat)
+        return newMqttEndpoint(bus, broker, config, retained)
+    default:
+        return newFabricEndpoint(bus, config)
+    }
+}
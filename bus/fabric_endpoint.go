@@ -0,0 +1,360 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+import (
+    "encoding/json"
+    "strconv"
+    "strings"
+    "sync"
+
+    "go-bifrost/model"
+    "go-bifrost/stompserver"
+)
+
+// EndpointConfig configures how a fabric endpoint maps EventBus channels onto broker
+// destinations.
+type EndpointConfig struct {
+    TopicPrefix           string
+    AppRequestPrefix      string
+    AppRequestQueuePrefix string
+    UserQueuePrefix       string
+    Heartbeat             int64
+
+    // Addr is the TCP address the endpoint's server/broker listens on (e.g. ":61613" for STOMP,
+    // ":1883" for MQTT). Empty uses that transport's conventional default port.
+    Addr string
+
+    // Authorizer, when set, gates CONNECT/SUBSCRIBE/application requests. Nil means every
+    // connection, subscription, and request is allowed, preserving prior behavior.
+    Authorizer Authorizer
+
+    // DurableChannels lists the bus channels whose published responses are retained so a STOMP
+    // SUBSCRIBE carrying an x-last-seq header can replay everything missed since that sequence
+    // before live traffic resumes. Retention on a channel starts once it has had its first
+    // subscriber on this endpoint. Channels not listed here behave exactly as before.
+    DurableChannels []string
+
+    // DurableRetention caps how many responses are retained per durable channel. 0 uses a
+    // sane default.
+    DurableRetention int
+}
+
+// durableSeqHeader is the custom STOMP header a reconnecting subscriber sets to the last
+// sequence number it successfully processed, requesting replay of everything since.
+const durableSeqHeader = "x-last-seq"
+
+// FabricEndpoint exposes EventBus channels over a network transport so remote clients can
+// subscribe to channels and send application requests onto the bus.
+type FabricEndpoint interface {
+    Start()
+    Stop()
+}
+
+// chanMapping tracks which conId#subId pairs are currently subscribed to a bus channel, so a
+// response published on the channel can be fanned out to every subscriber exactly once. The
+// value is the sequence number last delivered to that subscriber on a durable channel, by replay
+// or by live traffic (0 until anything has been delivered, and always 0 on non-durable channels).
+type chanMapping struct {
+    subs map[string]uint64
+}
+
+type fabricEndpoint struct {
+    bus             EventBus
+    server          stompserver.StompServer
+    config          EndpointConfig
+    chanMappings    map[string]*chanMapping
+    connHeaders     map[string]map[string]string
+    durable         *durableStore
+    durableChannels map[string]bool
+    lock            sync.Mutex
+}
+
+// newFabricEndpoint creates a FabricEndpoint backed by a stompserver.StompServer, bridging
+// EventBus channels onto STOMP destinations according to config. The server binds its own TCP
+// listener on config.Addr; STOMP-over-WebSocket is not implemented in this build.
+func newFabricEndpoint(bus EventBus, config EndpointConfig) FabricEndpoint {
+    config.TopicPrefix = normalizePrefix(config.TopicPrefix)
+    config.AppRequestPrefix = normalizePrefix(config.AppRequestPrefix)
+    config.AppRequestQueuePrefix = normalizePrefix(config.AppRequestQueuePrefix)
+    config.UserQueuePrefix = normalizePrefix(config.UserQueuePrefix)
+
+    durableChannels := make(map[string]bool, len(config.DurableChannels))
+    for _, channelName := range config.DurableChannels {
+        durableChannels[channelName] = true
+    }
+
+    fe := &fabricEndpoint{
+        bus:             bus,
+        config:          config,
+        chanMappings:    make(map[string]*chanMapping),
+        connHeaders:     make(map[string]map[string]string),
+        durable:         newDurableStore(config.DurableRetention),
+        durableChannels: durableChannels,
+    }
+    fe.server = stompserver.NewStompServer(config.Addr, config.Heartbeat)
+    fe.initHandlers()
+    return fe
+}
+
+// normalizePrefix ensures a non-empty destination prefix always ends in a single trailing slash,
+// so prefix matching and channel-name extraction can assume a consistent separator.
+func normalizePrefix(prefix string) string {
+    if prefix == "" || strings.HasSuffix(prefix, "/") {
+        return prefix
+    }
+    return prefix + "/"
+}
+
+func (fe *fabricEndpoint) Start() {
+    fe.server.Start()
+}
+
+func (fe *fabricEndpoint) Stop() {
+    fe.server.Stop()
+}
+
+func (fe *fabricEndpoint) initHandlers() {
+    fe.server.OnConnectEvent(fe.handleConnectEvent)
+    fe.server.OnSubscribeEvent(fe.handleSubscribeEvent)
+    fe.server.OnUnsubscribeEvent(fe.handleUnsubscribeEvent)
+    fe.server.OnApplicationRequest(fe.handleApplicationRequest)
+}
+
+// handleConnectEvent captures the CONNECT headers for conId so later SUBSCRIBE/SEND frames on
+// the same connection can be authorized against them, and rejects the connection outright if an
+// Authorizer is configured and refuses it.
+func (fe *fabricEndpoint) handleConnectEvent(conId string, headers map[string]string) {
+    fe.lock.Lock()
+    fe.connHeaders[conId] = headers
+    fe.lock.Unlock()
+
+    if fe.config.Authorizer == nil {
+        return
+    }
+    if err := fe.config.Authorizer.CanConnect(conId, headers); err != nil {
+        fe.server.SendMessageToClient(conId, "/error", []byte(err.Error()))
+        fe.server.DisconnectClient(conId)
+    }
+}
+
+// headersFor returns the CONNECT headers captured for conId, or an empty map if the connection
+// never sent one (e.g. in tests that drive handlers directly).
+func (fe *fabricEndpoint) headersFor(conId string) map[string]string {
+    fe.lock.Lock()
+    defer fe.lock.Unlock()
+    if headers, ok := fe.connHeaders[conId]; ok {
+        return headers
+    }
+    return map[string]string{}
+}
+
+// resolveChannel maps a subscribed destination onto a bus channel name, recognizing both the
+// broadcast topic prefix and the per-client user-queue prefix.
+func (fe *fabricEndpoint) resolveChannel(destination string) string {
+    if fe.config.TopicPrefix != "" && strings.HasPrefix(destination, fe.config.TopicPrefix) {
+        return strings.TrimPrefix(destination, fe.config.TopicPrefix)
+    }
+    if fe.config.UserQueuePrefix != "" && strings.HasPrefix(destination, fe.config.UserQueuePrefix) {
+        return strings.TrimPrefix(destination, fe.config.UserQueuePrefix)
+    }
+    return ""
+}
+
+func (fe *fabricEndpoint) handleSubscribeEvent(conId, subId, destination string, frame *stompserver.Frame) {
+    channelName := fe.resolveChannel(destination)
+    if channelName == "" || !fe.bus.GetChannelManager().CheckChannelExists(channelName) {
+        return
+    }
+
+    if fe.config.Authorizer != nil && !fe.config.Authorizer.CanSubscribe(conId, destination, fe.headersFor(conId)) {
+        fe.server.SendMessageToClient(conId, destination, []byte("not authorized to subscribe to "+destination))
+        return
+    }
+
+    fe.lock.Lock()
+    mapping, ok := fe.chanMappings[channelName]
+    if !ok {
+        mapping = &chanMapping{subs: make(map[string]uint64)}
+        fe.chanMappings[channelName] = mapping
+        fe.bridgeChannel(channelName)
+    }
+    fe.lock.Unlock()
+
+    lastSeq := fe.replayDurable(channelName, destination, conId, frame)
+
+    fe.lock.Lock()
+    defer fe.lock.Unlock()
+    mapping.subs[conId+"#"+subId] = lastSeq
+}
+
+// replayDurable sends conId every response retained for channelName since the sequence it
+// presents via the x-last-seq header, so a reconnecting subscriber catches up before live
+// traffic resumes. It returns the sequence that should be recorded as last-delivered.
+func (fe *fabricEndpoint) replayDurable(channelName, destination, conId string, frame *stompserver.Frame) uint64 {
+    if !fe.durableChannels[channelName] {
+        return 0
+    }
+
+    var fromSeq uint64
+    presented := false
+    if frame != nil {
+        if raw, ok := frame.Headers[durableSeqHeader]; ok {
+            presented = true
+            if parsed, err := strconv.ParseUint(raw, 10, 64); err == nil {
+                fromSeq = parsed
+            }
+        }
+    }
+
+    fe.server.SendMessageAfter(conId, destination, fromSeq)
+
+    // A subscriber that never presented x-last-seq is brand-new, not reconnecting, and gets no
+    // backlog at all -- fromSeq 0 is indistinguishable from an explicit "replay everything" absent
+    // this check.
+    if !presented {
+        return fromSeq
+    }
+
+    entries := fe.durable.after(channelName, fromSeq)
+    lastSeq := fromSeq
+    for _, e := range entries {
+        fe.server.SendMessageToClient(conId, destination, e.body)
+        lastSeq = e.seq
+    }
+    return lastSeq
+}
+
+func (fe *fabricEndpoint) handleUnsubscribeEvent(conId, subId, destination string) {
+    channelName := fe.resolveChannel(destination)
+    if channelName == "" {
+        return
+    }
+
+    fe.lock.Lock()
+    defer fe.lock.Unlock()
+
+    mapping, ok := fe.chanMappings[channelName]
+    if !ok {
+        return
+    }
+    delete(mapping.subs, conId+"#"+subId)
+    if len(mapping.subs) == 0 {
+        delete(fe.chanMappings, channelName)
+    }
+}
+
+// bridgeChannel listens to a bus channel's response stream and fans out every message to every
+// subscriber of the equivalent STOMP destination, honoring a per-message BrokerDestination when
+// the response targets a single connected client.
+func (fe *fabricEndpoint) bridgeChannel(channelName string) {
+    handler, err := fe.bus.ListenStream(channelName)
+    if err != nil {
+        return
+    }
+    handler.Handle(func(message *model.Message) {
+        fe.dispatch(channelName, message)
+    }, func(err error) {
+        fe.dispatchError(channelName, err)
+    })
+}
+
+func (fe *fabricEndpoint) dispatch(channelName string, message *model.Message) {
+    if dest := brokerDestination(message.Payload); dest != nil {
+        body, err := json.Marshal(message.Payload)
+        if err != nil {
+            return
+        }
+        fe.server.SendMessageToClient(dest.ConnectionId, dest.Destination, body)
+        return
+    }
+
+    body, err := toMessageBody(message.Payload)
+    if err != nil {
+        return
+    }
+
+    if fe.durableChannels[channelName] {
+        seq := fe.durable.append(channelName, body)
+        fe.lock.Lock()
+        if mapping, ok := fe.chanMappings[channelName]; ok {
+            for key := range mapping.subs {
+                mapping.subs[key] = seq
+            }
+        }
+        fe.lock.Unlock()
+    }
+
+    fe.lock.Lock()
+    _, hasSubs := fe.chanMappings[channelName]
+    fe.lock.Unlock()
+    if !hasSubs {
+        return
+    }
+
+    fe.server.SendMessage(fe.config.TopicPrefix+channelName, body)
+}
+
+func (fe *fabricEndpoint) dispatchError(channelName string, err error) {
+    fe.server.SendMessage(fe.config.TopicPrefix+channelName, []byte(err.Error()))
+}
+
+// toMessageBody converts a response payload to wire bytes: strings and []byte pass through
+// untouched so callers can send preformatted bodies, everything else is JSON-encoded.
+func toMessageBody(payload interface{}) ([]byte, error) {
+    switch p := payload.(type) {
+    case string:
+        return []byte(p), nil
+    case []byte:
+        return p, nil
+    default:
+        return json.Marshal(payload)
+    }
+}
+
+func brokerDestination(payload interface{}) *model.BrokerDestinationConfig {
+    switch p := payload.(type) {
+    case model.Response:
+        return p.BrokerDestination
+    case *model.Response:
+        return p.BrokerDestination
+    default:
+        return nil
+    }
+}
+
+// resolveRequestChannel maps an application-request destination onto a bus channel name,
+// reporting whether the request arrived on the private, per-client request queue.
+func (fe *fabricEndpoint) resolveRequestChannel(destination string) (channelName string, isQueue bool) {
+    if fe.config.AppRequestQueuePrefix != "" && strings.HasPrefix(destination, fe.config.AppRequestQueuePrefix) {
+        return strings.TrimPrefix(destination, fe.config.AppRequestQueuePrefix), true
+    }
+    if fe.config.AppRequestPrefix != "" && strings.HasPrefix(destination, fe.config.AppRequestPrefix) {
+        return strings.TrimPrefix(destination, fe.config.AppRequestPrefix), false
+    }
+    return "", false
+}
+
+func (fe *fabricEndpoint) handleApplicationRequest(destination string, payload []byte, conId string) {
+    channelName, isQueue := fe.resolveRequestChannel(destination)
+    if channelName == "" {
+        return
+    }
+
+    if fe.config.Authorizer != nil && !fe.config.Authorizer.CanPublish(conId, destination, payload) {
+        fe.server.SendMessageToClient(conId, destination, []byte("not authorized to publish to "+destination))
+        return
+    }
+
+    var req model.Request
+    if err := json.Unmarshal(payload, &req); err != nil {
+        return
+    }
+    if isQueue {
+        req.BrokerDestination = &model.BrokerDestinationConfig{
+            Destination:  fe.config.UserQueuePrefix + channelName,
+            ConnectionId: conId,
+        }
+    }
+    fe.bus.SendRequestMessage(channelName, req, req.Id)
+}
@@ -22,6 +22,9 @@ type MockStompServerMessage struct {
 type MockStompServer struct {
     started bool
     sentMessages []MockStompServerMessage
+    sendMessageAfterCalls []uint64
+    disconnectedClients []string
+    connectHandlerFunction stompserver.ConnectHandlerFunction
     subscribeHandlerFunction stompserver.SubscribeHandlerFunction
     unsubscribeHandlerFunction stompserver.UnsubscribeHandlerFunction
     applicationRequestHandlerFunction stompserver.ApplicationRequestHandlerFunction
@@ -54,6 +57,18 @@ func(s *MockStompServer) SendMessageToClient(conId string, destination string, m
     }
 }
 
+func(s *MockStompServer) SendMessageAfter(conId string, destination string, fromSeq uint64) {
+    s.sendMessageAfterCalls = append(s.sendMessageAfterCalls, fromSeq)
+}
+
+func(s *MockStompServer) DisconnectClient(conId string) {
+    s.disconnectedClients = append(s.disconnectedClients, conId)
+}
+
+func(s *MockStompServer) OnConnectEvent(callback stompserver.ConnectHandlerFunction) {
+    s.connectHandlerFunction = callback
+}
+
 func(s *MockStompServer) OnUnsubscribeEvent(callback stompserver.UnsubscribeHandlerFunction) {
     s.unsubscribeHandlerFunction = callback
 }
@@ -68,7 +83,7 @@ func(s *MockStompServer) OnSubscribeEvent(callback stompserver.SubscribeHandlerF
 
 func newTestFabricEndpoint(bus EventBus, config EndpointConfig) (*fabricEndpoint, *MockStompServer) {
 
-    fe := newFabricEndpoint(bus, nil, config).(*fabricEndpoint)
+    fe := newFabricEndpoint(bus, config).(*fabricEndpoint)
     ms := &MockStompServer{}
 
     fe.server = ms
@@ -130,19 +145,19 @@ func TestFabricEndpoint_SubscribeEvent(t *testing.T) {
     mockServer.subscribeHandlerFunction("con1", "sub1", "/topic/test-service", nil)
     assert.Equal(t, len(fe.chanMappings), 1)
     assert.Equal(t, len(fe.chanMappings["test-service"].subs), 1)
-    assert.Equal(t, fe.chanMappings["test-service"].subs["con1#sub1"], true)
+    assert.Contains(t, fe.chanMappings["test-service"].subs, "con1#sub1")
 
     // subscribe again to the same channel
     mockServer.subscribeHandlerFunction("con1", "sub2", "/topic/test-service", nil)
     assert.Equal(t, len(fe.chanMappings), 1)
     assert.Equal(t, len(fe.chanMappings["test-service"].subs), 2)
-    assert.Equal(t, fe.chanMappings["test-service"].subs["con1#sub2"], true)
+    assert.Contains(t, fe.chanMappings["test-service"].subs, "con1#sub2")
 
     // subscribe to queue channel
     mockServer.subscribeHandlerFunction("con1", "sub3", "/user/queue/test-service", nil)
     assert.Equal(t, len(fe.chanMappings), 1)
     assert.Equal(t, len(fe.chanMappings["test-service"].subs), 3)
-    assert.Equal(t, fe.chanMappings["test-service"].subs["con1#sub3"], true)
+    assert.Contains(t, fe.chanMappings["test-service"].subs, "con1#sub3")
 
     mockServer.wg = &sync.WaitGroup{}
     mockServer.wg.Add(1)
@@ -318,4 +333,131 @@ func TestFabricEndpoint_BridgeMessage(t *testing.T) {
     assert.Equal(t, *receivedReq2.Id, id2)
     assert.Equal(t, receivedReq2.BrokerDestination.ConnectionId, "con2")
     assert.Equal(t, receivedReq2.BrokerDestination.Destination, "/user/queue/request-channel")
+}
+
+// allowlistAuthorizer allows subscriptions/publishes only to destinations explicitly listed,
+// and connections only when a "token" header is present.
+type allowlistAuthorizer struct {
+    allowedDestinations map[string]bool
+}
+
+func (a *allowlistAuthorizer) CanConnect(conId string, headers map[string]string) error {
+    if headers["token"] == "" {
+        return errors.New("missing token header")
+    }
+    return nil
+}
+
+func (a *allowlistAuthorizer) CanSubscribe(conId string, destination string, headers map[string]string) bool {
+    return a.allowedDestinations[destination]
+}
+
+func (a *allowlistAuthorizer) CanPublish(conId string, destination string, payload []byte) bool {
+    return a.allowedDestinations[destination]
+}
+
+func TestFabricEndpoint_Authorizer_SubscribeMatrix(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{"/topic/allowed": true}}
+    fe, mockServer := newTestFabricEndpoint(bus,
+        EndpointConfig{TopicPrefix: "/topic", Authorizer: authorizer})
+
+    bus.GetChannelManager().CreateChannel("allowed")
+    bus.GetChannelManager().CreateChannel("denied")
+
+    // denied destination: chanMappings must not be updated, and an error frame is sent back.
+    mockServer.subscribeHandlerFunction("con1", "sub1", "/topic/denied", nil)
+    assert.Equal(t, len(fe.chanMappings), 0)
+    assert.Equal(t, len(mockServer.sentMessages), 1)
+    assert.Equal(t, mockServer.sentMessages[0].conId, "con1")
+
+    // allowed destination: subscription proceeds as normal.
+    mockServer.subscribeHandlerFunction("con1", "sub2", "/topic/allowed", nil)
+    assert.Equal(t, len(fe.chanMappings), 1)
+    assert.Contains(t, fe.chanMappings["allowed"].subs, "con1#sub2")
+}
+
+func TestFabricEndpoint_Authorizer_PublishMatrix(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{"/pub/allowed": true}}
+    _, mockServer := newTestFabricEndpoint(bus,
+        EndpointConfig{AppRequestPrefix: "/pub", Authorizer: authorizer})
+
+    bus.GetChannelManager().CreateChannel("allowed")
+    bus.GetChannelManager().CreateChannel("denied")
+
+    mh, _ := bus.ListenRequestStream("allowed")
+    var received []*model.Message
+    wg := sync.WaitGroup{}
+    mh.Handle(func(message *model.Message) {
+        received = append(received, message)
+        wg.Done()
+    }, func(e error) {
+        assert.Fail(t, "unexpected error")
+    })
+
+    deniedReq, _ := json.Marshal(model.Request{Request: "denied-request"})
+    mockServer.applicationRequestHandlerFunction("/pub/denied", deniedReq, "con1")
+    assert.Equal(t, len(mockServer.sentMessages), 1)
+
+    wg.Add(1)
+    allowedReq, _ := json.Marshal(model.Request{Request: "allowed-request"})
+    mockServer.applicationRequestHandlerFunction("/pub/allowed", allowedReq, "con1")
+    wg.Wait()
+
+    assert.Equal(t, len(received), 1)
+}
+
+func TestFabricEndpoint_Authorizer_ConnectEvent(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{}}
+    fe, mockServer := newTestFabricEndpoint(bus, EndpointConfig{Authorizer: authorizer})
+
+    mockServer.connectHandlerFunction("con1", map[string]string{})
+    assert.Equal(t, len(mockServer.sentMessages), 1)
+    assert.Equal(t, mockServer.disconnectedClients, []string{"con1"})
+
+    mockServer.connectHandlerFunction("con2", map[string]string{"token": "abc"})
+    assert.Equal(t, len(mockServer.sentMessages), 1)
+    assert.Equal(t, fe.headersFor("con2")["token"], "abc")
+    assert.Equal(t, mockServer.disconnectedClients, []string{"con1"})
+}
+
+func TestFabricEndpoint_DurableReplay(t *testing.T) {
+    bus := newTestEventBus()
+    fe, mockServer := newTestFabricEndpoint(bus,
+        EndpointConfig{TopicPrefix: "/topic", DurableChannels: []string{"test-service"}})
+
+    bus.GetChannelManager().CreateChannel("test-service")
+
+    // a first subscriber establishes the channel and receives three published messages.
+    mockServer.subscribeHandlerFunction("con1", "sub1", "/topic/test-service", nil)
+    assert.Equal(t, mockServer.sendMessageAfterCalls, []uint64{0})
+
+    mockServer.wg = &sync.WaitGroup{}
+    mockServer.wg.Add(3)
+    bus.SendResponseMessage("test-service", "msg1", nil)
+    bus.SendResponseMessage("test-service", "msg2", nil)
+    bus.SendResponseMessage("test-service", "msg3", nil)
+    mockServer.wg.Wait()
+    mockServer.wg = nil
+
+    assert.Equal(t, len(mockServer.sentMessages), 3)
+    assert.Equal(t, fe.chanMappings["test-service"].subs["con1#sub1"], uint64(3))
+
+    // a reconnecting subscriber presents x-last-seq and only receives what it missed.
+    mockServer.subscribeHandlerFunction("con2", "sub1", "/topic/test-service",
+        &stompserver.Frame{Headers: map[string]string{"x-last-seq": "1"}})
+
+    assert.Equal(t, mockServer.sendMessageAfterCalls, []uint64{0, 1})
+    assert.Equal(t, len(mockServer.sentMessages), 5)
+    assert.Equal(t, mockServer.sentMessages[3].conId, "con2")
+    assert.Equal(t, string(mockServer.sentMessages[3].Payload), "msg2")
+    assert.Equal(t, string(mockServer.sentMessages[4].Payload), "msg3")
+    assert.Equal(t, fe.chanMappings["test-service"].subs["con2#sub1"], uint64(3))
+
+    // a brand-new subscriber with no x-last-seq header gets no replay at all.
+    mockServer.subscribeHandlerFunction("con3", "sub1", "/topic/test-service", nil)
+    assert.Equal(t, mockServer.sendMessageAfterCalls, []uint64{0, 1, 0})
+    assert.Equal(t, len(mockServer.sentMessages), 5)
 }
\ No newline at end of file
@@ -0,0 +1,220 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+import (
+    "encoding/json"
+    "strings"
+    "sync"
+
+    "go-bifrost/model"
+    "go-bifrost/mqttserver"
+)
+
+// RetainedMessageStore persists the last message published on a retained-capable channel so it
+// can be replayed to newly-subscribed clients. A store.BusStore-backed implementation is the
+// expected production use, mirroring how galactic channels already persist state.
+type RetainedMessageStore interface {
+    Put(channelName string, payload []byte)
+    Get(channelName string) ([]byte, bool)
+}
+
+// mqttEndpoint exposes EventBus channels over MQTT, parallel to fabricEndpoint's STOMP bridge.
+// It reuses EndpointConfig so the two endpoints can be configured and run concurrently against
+// the same bus: StartFabricEndpoint selects between them with an EndpointType.
+type mqttEndpoint struct {
+    bus          EventBus
+    broker       mqttserver.MqttBroker
+    config       EndpointConfig
+    retained     RetainedMessageStore
+    chanMappings map[string]*chanMapping
+    connHeaders  map[string]map[string]string
+    lock         sync.Mutex
+}
+
+// newMqttEndpoint creates a FabricEndpoint backed by a mqttserver.MqttBroker, bridging EventBus
+// channels onto MQTT topics according to config. retained may be nil, in which case the last
+// response bridged from a bus channel is not replayed to future subscribers by the endpoint.
+func newMqttEndpoint(bus EventBus, broker mqttserver.MqttBroker, config EndpointConfig, retained RetainedMessageStore) FabricEndpoint {
+    config.TopicPrefix = normalizePrefix(config.TopicPrefix)
+    config.AppRequestPrefix = normalizePrefix(config.AppRequestPrefix)
+    config.AppRequestQueuePrefix = normalizePrefix(config.AppRequestQueuePrefix)
+    config.UserQueuePrefix = normalizePrefix(config.UserQueuePrefix)
+
+    me := &mqttEndpoint{
+        bus:          bus,
+        broker:       broker,
+        config:       config,
+        retained:     retained,
+        chanMappings: make(map[string]*chanMapping),
+        connHeaders:  make(map[string]map[string]string),
+    }
+    me.initHandlers()
+    return me
+}
+
+func (me *mqttEndpoint) Start() {
+    me.broker.Start()
+}
+
+func (me *mqttEndpoint) Stop() {
+    me.broker.Stop()
+}
+
+func (me *mqttEndpoint) initHandlers() {
+    me.broker.OnConnectEvent(me.handleConnectEvent)
+    me.broker.OnSubscribeEvent(me.handleSubscribeEvent)
+    me.broker.OnUnsubscribeEvent(me.handleUnsubscribeEvent)
+    me.broker.OnApplicationRequest(me.handleApplicationRequest)
+}
+
+// handleConnectEvent captures the CONNECT credentials for clientId so later SUBSCRIBE/PUBLISH
+// packets on the same connection can be authorized against them, and rejects the connection
+// outright if an Authorizer is configured and refuses it, mirroring fabricEndpoint's
+// handleConnectEvent for STOMP.
+func (me *mqttEndpoint) handleConnectEvent(clientId string, headers map[string]string) {
+    me.lock.Lock()
+    me.connHeaders[clientId] = headers
+    me.lock.Unlock()
+
+    if me.config.Authorizer == nil {
+        return
+    }
+    if err := me.config.Authorizer.CanConnect(clientId, headers); err != nil {
+        me.broker.DisconnectClient(clientId)
+    }
+}
+
+// headersFor returns the CONNECT credentials captured for clientId, or an empty map if the
+// connection never sent one (e.g. in tests that drive handlers directly).
+func (me *mqttEndpoint) headersFor(clientId string) map[string]string {
+    me.lock.Lock()
+    defer me.lock.Unlock()
+    if headers, ok := me.connHeaders[clientId]; ok {
+        return headers
+    }
+    return map[string]string{}
+}
+
+// clientTopic renders the per-client queue topic for a channel, following the MQTT convention
+// of namespacing private topics under $client/<id>/... rather than STOMP's /user/queue style.
+func (me *mqttEndpoint) clientTopic(clientId, channelName string) string {
+    return me.config.UserQueuePrefix + "$client/" + clientId + "/" + channelName
+}
+
+func (me *mqttEndpoint) resolveChannel(topic string) string {
+    if me.config.TopicPrefix != "" && strings.HasPrefix(topic, me.config.TopicPrefix) {
+        return strings.TrimPrefix(topic, me.config.TopicPrefix)
+    }
+    return ""
+}
+
+func (me *mqttEndpoint) handleSubscribeEvent(clientId, topic string, qos mqttserver.QoS) {
+    channelName := me.resolveChannel(topic)
+    if channelName == "" || !me.bus.GetChannelManager().CheckChannelExists(channelName) {
+        return
+    }
+
+    if me.config.Authorizer != nil && !me.config.Authorizer.CanSubscribe(clientId, topic, me.headersFor(clientId)) {
+        return
+    }
+
+    me.lock.Lock()
+    mapping, ok := me.chanMappings[channelName]
+    if !ok {
+        mapping = &chanMapping{subs: make(map[string]uint64)}
+        me.chanMappings[channelName] = mapping
+        me.bridgeChannel(channelName)
+    }
+    mapping.subs[clientId+"#"+topic] = 0
+    me.lock.Unlock()
+
+    if me.retained != nil {
+        if body, ok := me.retained.Get(channelName); ok {
+            me.broker.SendMessageToClient(clientId, topic, body, qos)
+        }
+    }
+}
+
+func (me *mqttEndpoint) handleUnsubscribeEvent(clientId, topic string) {
+    channelName := me.resolveChannel(topic)
+    if channelName == "" {
+        return
+    }
+
+    me.lock.Lock()
+    defer me.lock.Unlock()
+
+    mapping, ok := me.chanMappings[channelName]
+    if !ok {
+        return
+    }
+    delete(mapping.subs, clientId+"#"+topic)
+    if len(mapping.subs) == 0 {
+        delete(me.chanMappings, channelName)
+    }
+}
+
+func (me *mqttEndpoint) bridgeChannel(channelName string) {
+    handler, err := me.bus.ListenStream(channelName)
+    if err != nil {
+        return
+    }
+    handler.Handle(func(message *model.Message) {
+        me.dispatch(channelName, message)
+    }, func(err error) {
+        me.broker.SendMessage(me.config.TopicPrefix+channelName, []byte(err.Error()), mqttserver.QoSAtMostOnce, false)
+    })
+}
+
+func (me *mqttEndpoint) dispatch(channelName string, message *model.Message) {
+    body, err := toMessageBody(message.Payload)
+    if err != nil {
+        return
+    }
+
+    if dest := brokerDestination(message.Payload); dest != nil {
+        me.broker.SendMessageToClient(dest.ConnectionId, dest.Destination, body, mqttserver.QoSAtLeastOnce)
+        return
+    }
+
+    if me.retained != nil {
+        me.retained.Put(channelName, body)
+    }
+    me.broker.SendMessage(me.config.TopicPrefix+channelName, body, mqttserver.QoSAtLeastOnce, false)
+}
+
+func (me *mqttEndpoint) handleApplicationRequest(topic string, payload []byte, clientId string, qos mqttserver.QoS, retained bool) {
+    channelName, isClientTopic := me.resolveRequestChannel(topic)
+    if channelName == "" {
+        return
+    }
+
+    if me.config.Authorizer != nil && !me.config.Authorizer.CanPublish(clientId, topic, payload) {
+        return
+    }
+
+    var req model.Request
+    if err := json.Unmarshal(payload, &req); err != nil {
+        return
+    }
+    if isClientTopic {
+        req.BrokerDestination = &model.BrokerDestinationConfig{
+            Destination:  me.clientTopic(clientId, channelName),
+            ConnectionId: clientId,
+        }
+    }
+    me.bus.SendRequestMessage(channelName, req, req.Id)
+}
+
+// resolveRequestChannel maps an application-request topic onto a bus channel name, reporting
+// whether the request arrived on the client's private reply topic.
+func (me *mqttEndpoint) resolveRequestChannel(topic string) (channelName string, isClientTopic bool) {
+    if me.config.AppRequestQueuePrefix != "" && strings.HasPrefix(topic, me.config.AppRequestQueuePrefix) {
+        return strings.TrimPrefix(topic, me.config.AppRequestQueuePrefix), true
+    }
+    if me.config.AppRequestPrefix != "" && strings.HasPrefix(topic, me.config.AppRequestPrefix) {
+        return strings.TrimPrefix(topic, me.config.AppRequestPrefix), false
+    }
+    return "", false
+}
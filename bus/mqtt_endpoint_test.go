@@ -0,0 +1,192 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package bus
+
+import (
+    "encoding/json"
+    "sync"
+    "testing"
+
+    "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
+    "go-bifrost/model"
+    "go-bifrost/mqttserver"
+)
+
+type MockMqttBrokerMessage struct {
+    Topic    string
+    Payload  []byte
+    clientId string
+}
+
+type MockMqttBroker struct {
+    started                           bool
+    sentMessages                      []MockMqttBrokerMessage
+    disconnectedClients               []string
+    connectHandlerFunction            mqttserver.ConnectHandlerFunction
+    subscribeHandlerFunction          mqttserver.SubscribeHandlerFunction
+    unsubscribeHandlerFunction        mqttserver.UnsubscribeHandlerFunction
+    applicationRequestHandlerFunction mqttserver.ApplicationRequestHandlerFunction
+    wg                                *sync.WaitGroup
+}
+
+func (b *MockMqttBroker) Start() {
+    b.started = true
+}
+
+func (b *MockMqttBroker) Stop() {
+    b.started = false
+}
+
+func (b *MockMqttBroker) SendMessage(topic string, payload []byte, qos mqttserver.QoS, retained bool) {
+    b.sentMessages = append(b.sentMessages, MockMqttBrokerMessage{Topic: topic, Payload: payload})
+    if b.wg != nil {
+        b.wg.Done()
+    }
+}
+
+func (b *MockMqttBroker) SendMessageToClient(clientId string, topic string, payload []byte, qos mqttserver.QoS) {
+    b.sentMessages = append(b.sentMessages, MockMqttBrokerMessage{Topic: topic, Payload: payload, clientId: clientId})
+    if b.wg != nil {
+        b.wg.Done()
+    }
+}
+
+func (b *MockMqttBroker) DisconnectClient(clientId string) {
+    b.disconnectedClients = append(b.disconnectedClients, clientId)
+}
+
+func (b *MockMqttBroker) OnConnectEvent(callback mqttserver.ConnectHandlerFunction) {
+    b.connectHandlerFunction = callback
+}
+
+func (b *MockMqttBroker) OnSubscribeEvent(callback mqttserver.SubscribeHandlerFunction) {
+    b.subscribeHandlerFunction = callback
+}
+
+func (b *MockMqttBroker) OnUnsubscribeEvent(callback mqttserver.UnsubscribeHandlerFunction) {
+    b.unsubscribeHandlerFunction = callback
+}
+
+func (b *MockMqttBroker) OnApplicationRequest(callback mqttserver.ApplicationRequestHandlerFunction) {
+    b.applicationRequestHandlerFunction = callback
+}
+
+func newTestMqttEndpoint(bus EventBus, config EndpointConfig) (*mqttEndpoint, *MockMqttBroker) {
+    mb := &MockMqttBroker{}
+    me := newMqttEndpoint(bus, mb, config, nil).(*mqttEndpoint)
+    return me, mb
+}
+
+func TestMqttEndpoint_StartAndStop(t *testing.T) {
+    me, mockBroker := newTestMqttEndpoint(nil, EndpointConfig{})
+    assert.Equal(t, mockBroker.started, false)
+    me.Start()
+    assert.Equal(t, mockBroker.started, true)
+    me.Stop()
+    assert.Equal(t, mockBroker.started, false)
+}
+
+func TestMqttEndpoint_SubscribeEvent(t *testing.T) {
+    bus := newTestEventBus()
+    me, mockBroker := newTestMqttEndpoint(bus, EndpointConfig{TopicPrefix: "/topic"})
+
+    // subscribe to non-existing channel
+    mockBroker.subscribeHandlerFunction("client1", "/topic/test-service", mqttserver.QoSAtMostOnce)
+    assert.Equal(t, len(me.chanMappings), 0)
+
+    bus.GetChannelManager().CreateChannel("test-service")
+
+    // subscribe to valid channel
+    mockBroker.subscribeHandlerFunction("client1", "/topic/test-service", mqttserver.QoSAtMostOnce)
+    assert.Equal(t, len(me.chanMappings), 1)
+    assert.Contains(t, me.chanMappings["test-service"].subs, "client1#/topic/test-service")
+
+    mockBroker.wg = &sync.WaitGroup{}
+    mockBroker.wg.Add(1)
+    bus.SendResponseMessage("test-service", "test-message", nil)
+    mockBroker.wg.Wait()
+
+    assert.Equal(t, len(mockBroker.sentMessages), 1)
+    assert.Equal(t, mockBroker.sentMessages[0].Topic, "/topic/test-service")
+    assert.Equal(t, string(mockBroker.sentMessages[0].Payload), "test-message")
+
+    mockBroker.unsubscribeHandlerFunction("client1", "/topic/test-service")
+    assert.Equal(t, len(me.chanMappings), 0)
+}
+
+func TestMqttEndpoint_BridgeMessage(t *testing.T) {
+    bus := newTestEventBus()
+    _, mockBroker := newTestMqttEndpoint(bus, EndpointConfig{TopicPrefix: "/topic", AppRequestPrefix: "/pub"})
+
+    bus.GetChannelManager().CreateChannel("request-channel")
+    mh, _ := bus.ListenRequestStream("request-channel")
+    assert.NotNil(t, mh)
+
+    wg := sync.WaitGroup{}
+    var messages []*model.Message
+    mh.Handle(func(message *model.Message) {
+        messages = append(messages, message)
+        wg.Done()
+    }, func(e error) {
+        assert.Fail(t, "unexpected error")
+    })
+
+    id1 := uuid.New()
+    req1, _ := json.Marshal(model.Request{Request: "test-request", Payload: "test-rq", Id: &id1})
+
+    wg.Add(1)
+    mockBroker.applicationRequestHandlerFunction("/pub/request-channel", req1, "client1", mqttserver.QoSAtLeastOnce, false)
+    wg.Wait()
+
+    assert.Equal(t, len(messages), 1)
+    receivedReq := messages[0].Payload.(model.Request)
+    assert.Equal(t, receivedReq.Request, "test-request")
+    assert.Equal(t, receivedReq.Payload, "test-rq")
+    assert.Equal(t, *receivedReq.Id, id1)
+}
+
+func TestMqttEndpoint_Authorizer_ConnectEvent(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{}}
+    me, mockBroker := newTestMqttEndpoint(bus, EndpointConfig{Authorizer: authorizer})
+
+    mockBroker.connectHandlerFunction("client1", map[string]string{})
+    assert.Equal(t, mockBroker.disconnectedClients, []string{"client1"})
+
+    mockBroker.connectHandlerFunction("client2", map[string]string{"token": "abc"})
+    assert.Equal(t, me.headersFor("client2")["token"], "abc")
+    assert.Equal(t, mockBroker.disconnectedClients, []string{"client1"})
+}
+
+func TestMqttEndpoint_Authorizer_SubscribeMatrix(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{"/topic/allowed": true}}
+    me, mockBroker := newTestMqttEndpoint(bus,
+        EndpointConfig{TopicPrefix: "/topic", Authorizer: authorizer})
+
+    bus.GetChannelManager().CreateChannel("allowed")
+    bus.GetChannelManager().CreateChannel("denied")
+
+    mockBroker.subscribeHandlerFunction("client1", "/topic/allowed", mqttserver.QoSAtMostOnce)
+    assert.Contains(t, me.chanMappings, "allowed")
+
+    mockBroker.subscribeHandlerFunction("client1", "/topic/denied", mqttserver.QoSAtMostOnce)
+    assert.NotContains(t, me.chanMappings, "denied")
+}
+
+func TestMqttEndpoint_Authorizer_PublishMatrix(t *testing.T) {
+    bus := newTestEventBus()
+    authorizer := &allowlistAuthorizer{allowedDestinations: map[string]bool{"/pub/allowed": true}}
+    _, mockBroker := newTestMqttEndpoint(bus,
+        EndpointConfig{AppRequestPrefix: "/pub", Authorizer: authorizer})
+
+    bus.GetChannelManager().CreateChannel("allowed")
+    bus.GetChannelManager().CreateChannel("denied")
+
+    id := uuid.New()
+    req, _ := json.Marshal(model.Request{Request: "r", Payload: "p", Id: &id})
+
+    mockBroker.applicationRequestHandlerFunction("/pub/denied", req, "client1", mqttserver.QoSAtMostOnce, false)
+    assert.Equal(t, len(mockBroker.sentMessages), 0)
+}
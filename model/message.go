@@ -0,0 +1,47 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package model
+
+import "github.com/google/uuid"
+
+// BrokerDestinationConfig identifies a single connected client that a response should be routed
+// back to, rather than broadcast to every subscriber of a channel.
+type BrokerDestinationConfig struct {
+    Destination  string `json:"destination"`
+    ConnectionId string `json:"connectionId"`
+}
+
+// Request is the envelope application clients send onto the bus over a broker connection.
+type Request struct {
+    Id                *uuid.UUID               `json:"id,omitempty"`
+    Request           string                   `json:"request"`
+    Payload           interface{}               `json:"payload,omitempty"`
+    BrokerDestination *BrokerDestinationConfig `json:"-"`
+}
+
+// Response is the envelope delivered back to application clients over a broker connection.
+type Response struct {
+    Id                *uuid.UUID               `json:"id,omitempty"`
+    Payload           interface{}               `json:"payload,omitempty"`
+    Error             bool                     `json:"error,omitempty"`
+    ErrorMessage      string                   `json:"errorMessage,omitempty"`
+    BrokerDestination *BrokerDestinationConfig `json:"-"`
+}
+
+// Message is the internal envelope carried across EventBus channels.
+type Message struct {
+    Id        *uuid.UUID
+    Channel   string
+    Payload   interface{}
+    Error     bool
+    Direction Direction
+}
+
+// Direction indicates whether a Message is a request or a response on a channel.
+type Direction int
+
+const (
+    RequestDir Direction = iota
+    ResponseDir
+    ErrorDir
+)
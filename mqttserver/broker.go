@@ -0,0 +1,365 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package mqttserver
+
+import (
+    "bufio"
+    "net"
+    "sync"
+
+    "github.com/google/uuid"
+)
+
+// mqttClient is one connected client's live socket plus the last-will-and-testament it registered
+// at CONNECT time, if any.
+type mqttClient struct {
+    id        string
+    conn      net.Conn
+    writeLock sync.Mutex
+    will      *willMessage
+    graceful  bool
+}
+
+func (c *mqttClient) publish(topic string, packetId uint16, qos QoS, retain bool, payload []byte) {
+    c.writeLock.Lock()
+    defer c.writeLock.Unlock()
+    writePublish(c.conn, topic, packetId, qos, retain, payload)
+}
+
+// broker is the production MqttBroker implementation. It owns a real TCP listener, decodes MQTT
+// 3.1.1 control packets off every accepted connection, and implements the subset of the protocol
+// a bridged EventBus channel needs: CONNECT/CONNACK, PUBLISH at QoS 0/1 with retained-message
+// replay, SUBSCRIBE/UNSUBSCRIBE with exact-match topic filters (wildcard filters such as "+" and
+// "#" are not supported), PINGREQ/PINGRESP keepalives, and last-will delivery on an ungraceful
+// disconnect.
+type broker struct {
+    addr      string
+    heartbeat int64
+    ln        net.Listener
+    lock      sync.Mutex
+    started   bool
+    clients   map[string]*mqttClient
+
+    // subs maps a topic to every client subscribed to it and the QoS it was granted, so a publish
+    // can be fanned out at min(published qos, subscriber qos) per MQTT 3.1.1 section 3.3.1.
+    subs map[string]map[string]QoS
+
+    // retained holds the last retained PUBLISH payload per topic, replayed to every new
+    // subscriber of that topic before live traffic resumes.
+    retained map[string][]byte
+
+    onConnect   ConnectHandlerFunction
+    onSubscribe SubscribeHandlerFunction
+    onUnsub     UnsubscribeHandlerFunction
+    onAppReq    ApplicationRequestHandlerFunction
+}
+
+// NewMqttBroker creates the default MqttBroker used by mqttEndpoint outside of tests, listening
+// on addr (":1883" if empty, the IANA-assigned MQTT port).
+func NewMqttBroker(addr string, heartbeat int64) MqttBroker {
+    if addr == "" {
+        addr = ":1883"
+    }
+    return &broker{
+        addr:      addr,
+        heartbeat: heartbeat,
+        clients:   make(map[string]*mqttClient),
+        subs:      make(map[string]map[string]QoS),
+        retained:  make(map[string][]byte),
+    }
+}
+
+func (b *broker) Start() {
+    b.lock.Lock()
+    if b.started {
+        b.lock.Unlock()
+        return
+    }
+    ln, err := net.Listen("tcp", b.addr)
+    if err != nil {
+        b.lock.Unlock()
+        return
+    }
+    b.ln = ln
+    b.started = true
+    b.lock.Unlock()
+
+    go b.acceptLoop(ln)
+}
+
+func (b *broker) acceptLoop(ln net.Listener) {
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        go b.serve(conn)
+    }
+}
+
+func (b *broker) Stop() {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    if !b.started {
+        return
+    }
+    b.started = false
+    if b.ln != nil {
+        b.ln.Close()
+    }
+}
+
+// serve owns one client connection for its whole lifetime: it waits for CONNECT, then loops
+// reading packets until the socket closes or the client sends DISCONNECT.
+func (b *broker) serve(conn net.Conn) {
+    defer conn.Close()
+    reader := bufio.NewReader(conn)
+
+    first, err := readPacket(reader)
+    if err != nil || first.packetType != pktConnect {
+        return
+    }
+    connect, ok := parseConnect(first.payload)
+    if !ok {
+        return
+    }
+
+    clientId := connect.clientId
+    if clientId == "" {
+        clientId = uuid.New().String()
+    }
+
+    client := &mqttClient{id: clientId, conn: conn, will: connect.will}
+    b.lock.Lock()
+    b.clients[clientId] = client
+    b.lock.Unlock()
+
+    defer b.handleDisconnect(client)
+
+    if err := writeConnAck(conn, false, 0); err != nil {
+        return
+    }
+
+    if b.onConnect != nil {
+        headers := map[string]string{}
+        if connect.username != "" {
+            headers["username"] = connect.username
+        }
+        if connect.password != "" {
+            headers["password"] = connect.password
+        }
+        b.onConnect(clientId, headers)
+    }
+
+    for {
+        pkt, err := readPacket(reader)
+        if err != nil {
+            return
+        }
+
+        switch pkt.packetType {
+        case pktPublish:
+            b.handlePublish(client, pkt)
+        case pktSubscribe:
+            b.handleSubscribe(client, pkt)
+        case pktUnsubscribe:
+            b.handleUnsubscribe(client, pkt)
+        case pktPingReq:
+            writePingResp(conn)
+        case pktDisconnect:
+            client.graceful = true
+            return
+        }
+    }
+}
+
+func (b *broker) handlePublish(client *mqttClient, pkt *mqttPacket) {
+    qos := QoS((pkt.flags >> 1) & 0x03)
+    retain := pkt.flags&0x01 != 0
+
+    topic, packetId, body, ok := parsePublish(pkt.payload, qos)
+    if !ok {
+        return
+    }
+
+    if qos == QoSAtLeastOnce {
+        writePubAck(client.conn, packetId)
+    }
+
+    b.publishTopic(topic, body, qos, retain)
+
+    if b.onAppReq != nil {
+        b.onAppReq(topic, body, client.id, qos, retain)
+    }
+}
+
+// publishTopic stores/clears the retained payload for topic and fans it out to every directly
+// subscribed client, independent of whatever the bridged EventBus does with onAppReq.
+func (b *broker) publishTopic(topic string, body []byte, qos QoS, retain bool) {
+    if retain {
+        b.lock.Lock()
+        if len(body) == 0 {
+            delete(b.retained, topic)
+        } else {
+            b.retained[topic] = body
+        }
+        b.lock.Unlock()
+    }
+
+    b.lock.Lock()
+    subs := b.subs[topic]
+    targets := make(map[*mqttClient]QoS, len(subs))
+    for clientId, subQos := range subs {
+        if c, ok := b.clients[clientId]; ok {
+            targets[c] = minQoS(qos, subQos)
+        }
+    }
+    b.lock.Unlock()
+
+    for c, deliverQos := range targets {
+        c.publish(topic, nextPacketId(), deliverQos, retain, body)
+    }
+}
+
+func (b *broker) handleSubscribe(client *mqttClient, pkt *mqttPacket) {
+    packetId, topics, qoses, ok := parseSubscribe(pkt.payload)
+    if !ok {
+        return
+    }
+
+    granted := make([]byte, len(topics))
+    for i, topic := range topics {
+        qos := qoses[i]
+        if qos > QoSAtLeastOnce {
+            granted[i] = 0x80 // QoS 2 unsupported: reject this filter per section 3.9.3.
+            continue
+        }
+        granted[i] = byte(qos)
+
+        b.lock.Lock()
+        if b.subs[topic] == nil {
+            b.subs[topic] = make(map[string]QoS)
+        }
+        b.subs[topic][client.id] = qos
+        retained, hasRetained := b.retained[topic]
+        b.lock.Unlock()
+
+        if b.onSubscribe != nil {
+            b.onSubscribe(client.id, topic, qos)
+        }
+        if hasRetained {
+            client.publish(topic, nextPacketId(), qos, true, retained)
+        }
+    }
+
+    writeSubAck(client.conn, packetId, granted)
+}
+
+func (b *broker) handleUnsubscribe(client *mqttClient, pkt *mqttPacket) {
+    packetId, topics, ok := parseUnsubscribe(pkt.payload)
+    if !ok {
+        return
+    }
+
+    for _, topic := range topics {
+        b.lock.Lock()
+        if set, ok := b.subs[topic]; ok {
+            delete(set, client.id)
+            if len(set) == 0 {
+                delete(b.subs, topic)
+            }
+        }
+        b.lock.Unlock()
+
+        if b.onUnsub != nil {
+            b.onUnsub(client.id, topic)
+        }
+    }
+
+    writeUnsubAck(client.conn, packetId)
+}
+
+// handleDisconnect removes client from every subscription and the client registry, publishing
+// its last-will-and-testament first if the socket closed without a DISCONNECT packet.
+func (b *broker) handleDisconnect(client *mqttClient) {
+    if !client.graceful && client.will != nil {
+        b.publishTopic(client.will.topic, client.will.payload, client.will.qos, client.will.retain)
+    }
+
+    b.lock.Lock()
+    defer b.lock.Unlock()
+    delete(b.clients, client.id)
+    for topic, set := range b.subs {
+        delete(set, client.id)
+        if len(set) == 0 {
+            delete(b.subs, topic)
+        }
+    }
+}
+
+func (b *broker) SendMessage(topic string, payload []byte, qos QoS, retained bool) {
+    b.publishTopic(topic, payload, qos, retained)
+}
+
+func (b *broker) SendMessageToClient(clientId string, topic string, payload []byte, qos QoS) {
+    b.lock.Lock()
+    client, ok := b.clients[clientId]
+    b.lock.Unlock()
+    if !ok {
+        return
+    }
+    client.publish(topic, nextPacketId(), qos, false, payload)
+}
+
+// DisconnectClient closes clientId's socket. serve's read loop then exits on the resulting error
+// and handleDisconnect runs via its deferred call, so no separate bookkeeping is needed here.
+func (b *broker) DisconnectClient(clientId string) {
+    b.lock.Lock()
+    client, ok := b.clients[clientId]
+    b.lock.Unlock()
+    if !ok {
+        return
+    }
+    client.conn.Close()
+}
+
+func (b *broker) OnConnectEvent(callback ConnectHandlerFunction) {
+    b.onConnect = callback
+}
+
+func (b *broker) OnSubscribeEvent(callback SubscribeHandlerFunction) {
+    b.onSubscribe = callback
+}
+
+func (b *broker) OnUnsubscribeEvent(callback UnsubscribeHandlerFunction) {
+    b.onUnsub = callback
+}
+
+func (b *broker) OnApplicationRequest(callback ApplicationRequestHandlerFunction) {
+    b.onAppReq = callback
+}
+
+func minQoS(a, b QoS) QoS {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+// nextPacketId hands out a broker-generated packet id for outbound QoS 1 PUBLISH packets. The
+// broker never retries unacknowledged deliveries, so packet ids only need to be non-zero and
+// distinct enough for a client to correlate its own PUBACK; they are not tracked afterward.
+var (
+    packetIdLock sync.Mutex
+    lastPacketId uint16
+)
+
+func nextPacketId() uint16 {
+    packetIdLock.Lock()
+    defer packetIdLock.Unlock()
+    lastPacketId++
+    if lastPacketId == 0 {
+        lastPacketId = 1
+    }
+    return lastPacketId
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+// Package mqttserver abstracts an MQTT 3.1.1 broker endpoint so the bus package can bridge
+// EventBus channels onto MQTT topics without depending on a concrete broker implementation,
+// mirroring the role stompserver plays for the STOMP fabric endpoint.
+package mqttserver
+
+// QoS is the MQTT quality-of-service level a message is published or subscribed at.
+type QoS byte
+
+const (
+    QoSAtMostOnce  QoS = 0
+    QoSAtLeastOnce QoS = 1
+)
+
+// ConnectHandlerFunction is invoked when a client sends a CONNECT packet, carrying whatever
+// credentials it presented (username/password, under the "username"/"password" keys) as headers,
+// mirroring stompserver's ConnectHandlerFunction so the two transports can share an Authorizer.
+type ConnectHandlerFunction func(clientId string, headers map[string]string)
+
+// SubscribeHandlerFunction is invoked when a client sends a SUBSCRIBE packet.
+type SubscribeHandlerFunction func(clientId string, topic string, qos QoS)
+
+// UnsubscribeHandlerFunction is invoked when a client sends an UNSUBSCRIBE packet.
+type UnsubscribeHandlerFunction func(clientId string, topic string)
+
+// ApplicationRequestHandlerFunction is invoked when a client PUBLISHes an application request.
+type ApplicationRequestHandlerFunction func(topic string, payload []byte, clientId string, qos QoS, retained bool)
+
+// MqttBroker is the transport surface a mqttEndpoint drives. Implementations own the underlying
+// listener and MQTT protocol handling, including LWT delivery and retained-message storage;
+// tests substitute a mock.
+type MqttBroker interface {
+    Start()
+    Stop()
+    SendMessage(topic string, payload []byte, qos QoS, retained bool)
+    SendMessageToClient(clientId string, topic string, payload []byte, qos QoS)
+
+    // DisconnectClient forcibly closes clientId's connection, e.g. after an Authorizer refuses a
+    // CONNECT. It is a no-op if clientId is unknown or already gone.
+    DisconnectClient(clientId string)
+
+    OnConnectEvent(callback ConnectHandlerFunction)
+    OnSubscribeEvent(callback SubscribeHandlerFunction)
+    OnUnsubscribeEvent(callback UnsubscribeHandlerFunction)
+    OnApplicationRequest(callback ApplicationRequestHandlerFunction)
+}
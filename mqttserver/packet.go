@@ -0,0 +1,362 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package mqttserver
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+)
+
+// MQTT 3.1.1 control packet types (section 2.2.1 of the spec). Only the types a broker needs to
+// read or write for QoS 0/1 pub-sub are represented; QoS 2's PUBREC/PUBREL/PUBCOMP are unused
+// since QoS only defines AtMostOnce/AtLeastOnce.
+const (
+    pktConnect     byte = 1
+    pktConnAck     byte = 2
+    pktPublish     byte = 3
+    pktPubAck      byte = 4
+    pktSubscribe   byte = 8
+    pktSubAck      byte = 9
+    pktUnsubscribe byte = 10
+    pktUnsubAck    byte = 11
+    pktPingReq     byte = 12
+    pktPingResp    byte = 13
+    pktDisconnect  byte = 14
+)
+
+// mqttPacket is one decoded control packet: its type, the fixed-header flags, and the raw
+// variable-header-plus-payload bytes, still waiting to be parsed according to packetType.
+type mqttPacket struct {
+    packetType byte
+    flags      byte
+    payload    []byte
+}
+
+// readPacket reads one complete MQTT control packet off r, decoding the fixed header and
+// reading exactly remaining-length bytes of payload so parsing never reads into the next packet.
+func readPacket(r io.Reader) (*mqttPacket, error) {
+    var first [1]byte
+    if _, err := io.ReadFull(r, first[:]); err != nil {
+        return nil, err
+    }
+
+    length, err := readRemainingLength(r)
+    if err != nil {
+        return nil, err
+    }
+
+    payload := make([]byte, length)
+    if length > 0 {
+        if _, err := io.ReadFull(r, payload); err != nil {
+            return nil, err
+        }
+    }
+
+    return &mqttPacket{packetType: first[0] >> 4, flags: first[0] & 0x0F, payload: payload}, nil
+}
+
+func readRemainingLength(r io.Reader) (int, error) {
+    multiplier := 1
+    value := 0
+    var b [1]byte
+    for i := 0; i < 4; i++ {
+        if _, err := io.ReadFull(r, b[:]); err != nil {
+            return 0, err
+        }
+        value += int(b[0]&0x7F) * multiplier
+        if b[0]&0x80 == 0 {
+            return value, nil
+        }
+        multiplier *= 128
+    }
+    return 0, fmt.Errorf("mqttserver: malformed remaining length")
+}
+
+func encodeRemainingLength(n int) []byte {
+    var out []byte
+    for {
+        b := byte(n % 128)
+        n /= 128
+        if n > 0 {
+            b |= 0x80
+        }
+        out = append(out, b)
+        if n == 0 {
+            return out
+        }
+    }
+}
+
+// cursor parses the fixed-order fields of a packet's payload, matching the reader idiom used
+// throughout this file: every read reports ok=false on underrun instead of panicking so a
+// truncated or malformed packet just gets dropped by the caller.
+type cursor struct {
+    buf []byte
+    pos int
+}
+
+func (c *cursor) readByte() (byte, bool) {
+    if c.pos >= len(c.buf) {
+        return 0, false
+    }
+    b := c.buf[c.pos]
+    c.pos++
+    return b, true
+}
+
+func (c *cursor) readUint16() (uint16, bool) {
+    if c.pos+2 > len(c.buf) {
+        return 0, false
+    }
+    v := binary.BigEndian.Uint16(c.buf[c.pos : c.pos+2])
+    c.pos += 2
+    return v, true
+}
+
+func (c *cursor) readBytes(n int) ([]byte, bool) {
+    if n < 0 || c.pos+n > len(c.buf) {
+        return nil, false
+    }
+    b := c.buf[c.pos : c.pos+n]
+    c.pos += n
+    return b, true
+}
+
+func (c *cursor) readBinary() ([]byte, bool) {
+    n, ok := c.readUint16()
+    if !ok {
+        return nil, false
+    }
+    return c.readBytes(int(n))
+}
+
+func (c *cursor) readString() (string, bool) {
+    b, ok := c.readBinary()
+    if !ok {
+        return "", false
+    }
+    return string(b), true
+}
+
+func (c *cursor) remaining() []byte {
+    return c.buf[c.pos:]
+}
+
+// willMessage is the optional last-will-and-testament a client registers at CONNECT time, to be
+// published by the broker if that client disconnects without a clean DISCONNECT.
+type willMessage struct {
+    topic   string
+    payload []byte
+    qos     QoS
+    retain  bool
+}
+
+// connectPacket is a parsed CONNECT payload.
+type connectPacket struct {
+    clientId     string
+    cleanSession bool
+    keepalive    uint16
+    will         *willMessage
+    username     string
+    password     string
+}
+
+// parseConnect decodes a CONNECT packet's variable header and payload (MQTT 3.1.1 section 3.1).
+func parseConnect(payload []byte) (*connectPacket, bool) {
+    c := &cursor{buf: payload}
+
+    if _, ok := c.readString(); !ok { // protocol name
+        return nil, false
+    }
+    if _, ok := c.readByte(); !ok { // protocol level
+        return nil, false
+    }
+    flags, ok := c.readByte()
+    if !ok {
+        return nil, false
+    }
+    keepalive, ok := c.readUint16()
+    if !ok {
+        return nil, false
+    }
+    clientId, ok := c.readString()
+    if !ok {
+        return nil, false
+    }
+
+    pkt := &connectPacket{clientId: clientId, cleanSession: flags&0x02 != 0, keepalive: keepalive}
+
+    if flags&0x04 != 0 {
+        topic, ok := c.readString()
+        if !ok {
+            return nil, false
+        }
+        body, ok := c.readBinary()
+        if !ok {
+            return nil, false
+        }
+        pkt.will = &willMessage{topic: topic, payload: body, qos: QoS((flags >> 3) & 0x03), retain: flags&0x20 != 0}
+    }
+    if flags&0x80 != 0 {
+        username, ok := c.readString()
+        if !ok {
+            return nil, false
+        }
+        pkt.username = username
+    }
+    if flags&0x40 != 0 {
+        password, ok := c.readBinary()
+        if !ok {
+            return nil, false
+        }
+        pkt.password = string(password)
+    }
+    return pkt, true
+}
+
+// parsePublish decodes a PUBLISH packet's topic, packet id (present only for QoS > 0) and body.
+func parsePublish(payload []byte, qos QoS) (topic string, packetId uint16, body []byte, ok bool) {
+    c := &cursor{buf: payload}
+    topic, ok = c.readString()
+    if !ok {
+        return "", 0, nil, false
+    }
+    if qos > 0 {
+        packetId, ok = c.readUint16()
+        if !ok {
+            return "", 0, nil, false
+        }
+    }
+    return topic, packetId, c.remaining(), true
+}
+
+// parseSubscribe decodes a SUBSCRIBE packet's id and its list of (topic filter, requested QoS)
+// pairs.
+func parseSubscribe(payload []byte) (packetId uint16, topics []string, qoses []QoS, ok bool) {
+    c := &cursor{buf: payload}
+    packetId, ok = c.readUint16()
+    if !ok {
+        return 0, nil, nil, false
+    }
+    for c.pos < len(c.buf) {
+        topic, k := c.readString()
+        if !k {
+            return 0, nil, nil, false
+        }
+        q, k := c.readByte()
+        if !k {
+            return 0, nil, nil, false
+        }
+        topics = append(topics, topic)
+        qoses = append(qoses, QoS(q))
+    }
+    return packetId, topics, qoses, true
+}
+
+// parseUnsubscribe decodes an UNSUBSCRIBE packet's id and its list of topic filters.
+func parseUnsubscribe(payload []byte) (packetId uint16, topics []string, ok bool) {
+    c := &cursor{buf: payload}
+    packetId, ok = c.readUint16()
+    if !ok {
+        return 0, nil, false
+    }
+    for c.pos < len(c.buf) {
+        topic, k := c.readString()
+        if !k {
+            return 0, nil, false
+        }
+        topics = append(topics, topic)
+    }
+    return packetId, topics, true
+}
+
+func writeFixedHeader(w io.Writer, packetType byte, flags byte, remainingLen int) error {
+    header := append([]byte{(packetType << 4) | flags}, encodeRemainingLength(remainingLen)...)
+    _, err := w.Write(header)
+    return err
+}
+
+func writeMqttString(buf *bytes.Buffer, s string) {
+    writeMqttBinary(buf, []byte(s))
+}
+
+func writeMqttBinary(buf *bytes.Buffer, b []byte) {
+    var lenBuf [2]byte
+    binary.BigEndian.PutUint16(lenBuf[:], uint16(len(b)))
+    buf.Write(lenBuf[:])
+    buf.Write(b)
+}
+
+func writeConnAck(w io.Writer, sessionPresent bool, returnCode byte) error {
+    var sp byte
+    if sessionPresent {
+        sp = 1
+    }
+    if err := writeFixedHeader(w, pktConnAck, 0, 2); err != nil {
+        return err
+    }
+    _, err := w.Write([]byte{sp, returnCode})
+    return err
+}
+
+func writeSubAck(w io.Writer, packetId uint16, granted []byte) error {
+    var buf bytes.Buffer
+    var idBuf [2]byte
+    binary.BigEndian.PutUint16(idBuf[:], packetId)
+    buf.Write(idBuf[:])
+    buf.Write(granted)
+    if err := writeFixedHeader(w, pktSubAck, 0, buf.Len()); err != nil {
+        return err
+    }
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+func writeUnsubAck(w io.Writer, packetId uint16) error {
+    var idBuf [2]byte
+    binary.BigEndian.PutUint16(idBuf[:], packetId)
+    if err := writeFixedHeader(w, pktUnsubAck, 0, 2); err != nil {
+        return err
+    }
+    _, err := w.Write(idBuf[:])
+    return err
+}
+
+func writePubAck(w io.Writer, packetId uint16) error {
+    var idBuf [2]byte
+    binary.BigEndian.PutUint16(idBuf[:], packetId)
+    if err := writeFixedHeader(w, pktPubAck, 0, 2); err != nil {
+        return err
+    }
+    _, err := w.Write(idBuf[:])
+    return err
+}
+
+func writePingResp(w io.Writer) error {
+    return writeFixedHeader(w, pktPingResp, 0, 0)
+}
+
+func writePublish(w io.Writer, topic string, packetId uint16, qos QoS, retain bool, payload []byte) error {
+    var buf bytes.Buffer
+    writeMqttString(&buf, topic)
+    if qos > 0 {
+        var idBuf [2]byte
+        binary.BigEndian.PutUint16(idBuf[:], packetId)
+        buf.Write(idBuf[:])
+    }
+    buf.Write(payload)
+
+    var flags byte
+    if retain {
+        flags |= 0x01
+    }
+    flags |= byte(qos) << 1
+
+    if err := writeFixedHeader(w, pktPublish, flags, buf.Len()); err != nil {
+        return err
+    }
+    _, err := w.Write(buf.Bytes())
+    return err
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package stompserver
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// maxFrameBodyBytes caps the body size a content-length header can request, so a malformed or
+// hostile frame can't drive an unbounded or negative allocation.
+const maxFrameBodyBytes = 64 * 1024 * 1024
+
+// wireFrame is one decoded STOMP frame: its command, headers (unordered; a repeated header keeps
+// its last value), and body.
+type wireFrame struct {
+    command string
+    headers map[string]string
+    body    []byte
+}
+
+// readWireFrame reads one STOMP frame off reader, per the STOMP 1.2 frame grammar. A bare
+// newline between frames is a heartbeat and is skipped rather than treated as an empty command.
+func readWireFrame(reader *bufio.Reader) (*wireFrame, error) {
+    line, err := reader.ReadString('\n')
+    if err != nil {
+        return nil, err
+    }
+    command := strings.TrimRight(line, "\r\n")
+    if command == "" {
+        return readWireFrame(reader)
+    }
+
+    headers := make(map[string]string)
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        trimmed := strings.TrimRight(line, "\r\n")
+        if trimmed == "" {
+            break
+        }
+        parts := strings.SplitN(trimmed, ":", 2)
+        if len(parts) == 2 {
+            headers[parts[0]] = parts[1]
+        }
+    }
+
+    if raw, ok := headers["content-length"]; ok {
+        if n, err := strconv.Atoi(raw); err == nil {
+            if n < 0 || n > maxFrameBodyBytes {
+                return nil, errors.New("stompserver: invalid content-length " + raw)
+            }
+            body := make([]byte, n)
+            if _, err := io.ReadFull(reader, body); err != nil {
+                return nil, err
+            }
+            if _, err := reader.ReadByte(); err != nil { // trailing NUL
+                return nil, err
+            }
+            return &wireFrame{command: command, headers: headers, body: body}, nil
+        }
+    }
+
+    body, err := reader.ReadString(0)
+    if err != nil {
+        return nil, err
+    }
+    return &wireFrame{command: command, headers: headers, body: []byte(strings.TrimSuffix(body, "\x00"))}, nil
+}
+
+// writeWireFrame serializes command/headers/body onto w using the STOMP 1.2 frame grammar.
+func writeWireFrame(w io.Writer, command string, headers map[string]string, body []byte) error {
+    var b strings.Builder
+    b.WriteString(command)
+    b.WriteByte('\n')
+    for k, v := range headers {
+        b.WriteString(k)
+        b.WriteByte(':')
+        b.WriteString(v)
+        b.WriteByte('\n')
+    }
+    b.WriteByte('\n')
+    _, err := w.Write([]byte(b.String()))
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(body); err != nil {
+        return err
+    }
+    _, err = w.Write([]byte{0})
+    return err
+}
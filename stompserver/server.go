@@ -0,0 +1,292 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+package stompserver
+
+import (
+    "bufio"
+    "net"
+    "strconv"
+    "sync"
+
+    "github.com/google/uuid"
+)
+
+// stompConnection is one connected client's live socket plus its current subscriptions, indexed
+// both ways so a SEND/fan-out can find a subscription id by destination and an UNSUBSCRIBE can
+// find a destination by subscription id.
+type stompConnection struct {
+    id         string
+    conn       net.Conn
+    writeLock  sync.Mutex
+    subsByDest map[string]string
+    subsById   map[string]string
+}
+
+func (c *stompConnection) send(command string, headers map[string]string, body []byte) {
+    c.writeLock.Lock()
+    defer c.writeLock.Unlock()
+    writeWireFrame(c.conn, command, headers, body)
+}
+
+// server is the production StompServer implementation. It owns a real TCP listener, decodes
+// STOMP 1.2 frames off every accepted connection, and implements the subset of the protocol a
+// bridged EventBus channel needs: CONNECT/CONNECTED, SUBSCRIBE/UNSUBSCRIBE, SEND (dispatched as
+// an application request), DISCONNECT, and server-to-client MESSAGE fan-out. STOMP-over-WebSocket
+// is not implemented in this build; only the raw TCP transport is served.
+type server struct {
+    addr      string
+    heartbeat int64
+    ln        net.Listener
+    lock      sync.Mutex
+    started   bool
+    conns     map[string]*stompConnection
+
+    // destSubs maps a destination to every connection subscribed to it, so SendMessage can fan
+    // out to all of them without conns needing to track reverse references.
+    destSubs map[string]map[string]bool
+
+    onConnect   ConnectHandlerFunction
+    onSubscribe SubscribeHandlerFunction
+    onUnsub     UnsubscribeHandlerFunction
+    onAppReq    ApplicationRequestHandlerFunction
+}
+
+// NewStompServer creates the default StompServer used by fabricEndpoint outside of tests,
+// listening on addr (":61613" if empty, the conventional STOMP port).
+func NewStompServer(addr string, heartbeat int64) StompServer {
+    if addr == "" {
+        addr = ":61613"
+    }
+    return &server{
+        addr:      addr,
+        heartbeat: heartbeat,
+        conns:     make(map[string]*stompConnection),
+        destSubs:  make(map[string]map[string]bool),
+    }
+}
+
+func (s *server) Start() {
+    s.lock.Lock()
+    if s.started {
+        s.lock.Unlock()
+        return
+    }
+    ln, err := net.Listen("tcp", s.addr)
+    if err != nil {
+        s.lock.Unlock()
+        return
+    }
+    s.ln = ln
+    s.started = true
+    s.lock.Unlock()
+
+    go s.acceptLoop(ln)
+}
+
+func (s *server) acceptLoop(ln net.Listener) {
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            return
+        }
+        go s.serve(conn)
+    }
+}
+
+func (s *server) Stop() {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if !s.started {
+        return
+    }
+    s.started = false
+    if s.ln != nil {
+        s.ln.Close()
+    }
+}
+
+// serve owns one client connection for its whole lifetime: it waits for CONNECT/STOMP, then
+// loops reading frames until the socket closes or the client sends DISCONNECT.
+func (s *server) serve(conn net.Conn) {
+    defer conn.Close()
+    reader := bufio.NewReader(conn)
+
+    first, err := readWireFrame(reader)
+    if err != nil || (first.command != "CONNECT" && first.command != "STOMP") {
+        return
+    }
+
+    sc := &stompConnection{
+        id:         uuid.New().String(),
+        conn:       conn,
+        subsByDest: make(map[string]string),
+        subsById:   make(map[string]string),
+    }
+
+    s.lock.Lock()
+    s.conns[sc.id] = sc
+    s.lock.Unlock()
+    defer s.cleanupConn(sc.id)
+
+    if s.onConnect != nil {
+        s.onConnect(sc.id, first.headers)
+    }
+
+    sc.send("CONNECTED", map[string]string{"version": "1.2"}, nil)
+
+    for {
+        frame, err := readWireFrame(reader)
+        if err != nil {
+            return
+        }
+
+        switch frame.command {
+        case "SUBSCRIBE":
+            s.handleSubscribe(sc, frame)
+        case "UNSUBSCRIBE":
+            s.handleUnsubscribe(sc, frame)
+        case "SEND":
+            if dest := frame.headers["destination"]; dest != "" && s.onAppReq != nil {
+                s.onAppReq(dest, frame.body, sc.id)
+            }
+        case "DISCONNECT":
+            if receipt := frame.headers["receipt"]; receipt != "" {
+                sc.send("RECEIPT", map[string]string{"receipt-id": receipt}, nil)
+            }
+            return
+        }
+    }
+}
+
+func (s *server) handleSubscribe(sc *stompConnection, frame *wireFrame) {
+    destination := frame.headers["destination"]
+    subId := frame.headers["id"]
+    if destination == "" || subId == "" {
+        return
+    }
+
+    s.lock.Lock()
+    sc.subsByDest[destination] = subId
+    sc.subsById[subId] = destination
+    if s.destSubs[destination] == nil {
+        s.destSubs[destination] = make(map[string]bool)
+    }
+    s.destSubs[destination][sc.id] = true
+    s.lock.Unlock()
+
+    if s.onSubscribe != nil {
+        s.onSubscribe(sc.id, subId, destination, &Frame{Headers: frame.headers})
+    }
+}
+
+func (s *server) handleUnsubscribe(sc *stompConnection, frame *wireFrame) {
+    subId := frame.headers["id"]
+
+    s.lock.Lock()
+    destination, ok := sc.subsById[subId]
+    if ok {
+        delete(sc.subsById, subId)
+        delete(sc.subsByDest, destination)
+        if set := s.destSubs[destination]; set != nil {
+            delete(set, sc.id)
+            if len(set) == 0 {
+                delete(s.destSubs, destination)
+            }
+        }
+    }
+    s.lock.Unlock()
+
+    if ok && s.onUnsub != nil {
+        s.onUnsub(sc.id, subId, destination)
+    }
+}
+
+// cleanupConn removes conId from every subscription and the connection registry once its socket
+// closes, whether that was a graceful DISCONNECT or the client simply dropping off.
+func (s *server) cleanupConn(conId string) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    sc, ok := s.conns[conId]
+    if !ok {
+        return
+    }
+    for destination := range sc.subsByDest {
+        if set := s.destSubs[destination]; set != nil {
+            delete(set, conId)
+            if len(set) == 0 {
+                delete(s.destSubs, destination)
+            }
+        }
+    }
+    delete(s.conns, conId)
+}
+
+func (s *server) SendMessage(destination string, messageBody []byte) {
+    s.lock.Lock()
+    set := s.destSubs[destination]
+    conIds := make([]string, 0, len(set))
+    for conId := range set {
+        conIds = append(conIds, conId)
+    }
+    s.lock.Unlock()
+
+    for _, conId := range conIds {
+        s.SendMessageToClient(conId, destination, messageBody)
+    }
+}
+
+func (s *server) SendMessageToClient(conId string, destination string, messageBody []byte) {
+    s.lock.Lock()
+    sc, ok := s.conns[conId]
+    var subId string
+    if ok {
+        subId = sc.subsByDest[destination]
+    }
+    s.lock.Unlock()
+    if !ok {
+        return
+    }
+
+    headers := map[string]string{
+        "destination":    destination,
+        "message-id":     uuid.New().String(),
+        "content-length": strconv.Itoa(len(messageBody)),
+    }
+    if subId != "" {
+        headers["subscription"] = subId
+    }
+    sc.send("MESSAGE", headers, messageBody)
+}
+
+func (s *server) SendMessageAfter(conId string, destination string, fromSeq uint64) {
+    // no frame-ordering fence needed by the default implementation.
+}
+
+// DisconnectClient closes conId's socket. serve's read loop then exits on the resulting error
+// and cleanupConn runs via its deferred call, so no separate bookkeeping is needed here.
+func (s *server) DisconnectClient(conId string) {
+    s.lock.Lock()
+    sc, ok := s.conns[conId]
+    s.lock.Unlock()
+    if !ok {
+        return
+    }
+    sc.conn.Close()
+}
+
+func (s *server) OnConnectEvent(callback ConnectHandlerFunction) {
+    s.onConnect = callback
+}
+
+func (s *server) OnSubscribeEvent(callback SubscribeHandlerFunction) {
+    s.onSubscribe = callback
+}
+
+func (s *server) OnUnsubscribeEvent(callback UnsubscribeHandlerFunction) {
+    s.onUnsub = callback
+}
+
+func (s *server) OnApplicationRequest(callback ApplicationRequestHandlerFunction) {
+    s.onAppReq = callback
+}
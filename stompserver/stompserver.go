@@ -0,0 +1,48 @@
+// Copyright 2019 VMware, Inc. All rights reserved. -- VMware Confidential
+
+// Package stompserver abstracts a STOMP broker endpoint so the bus package can bridge EventBus
+// channels onto STOMP destinations without depending on a concrete transport implementation.
+package stompserver
+
+// Frame carries the raw headers of the STOMP frame that triggered a handler (e.g. a SUBSCRIBE's
+// x-last-seq). It does not include the CONNECT headers of the same conId; those are delivered
+// once, to the ConnectHandlerFunction.
+type Frame struct {
+    Headers map[string]string
+}
+
+// ConnectHandlerFunction is invoked when a client sends a CONNECT frame, carrying the full set
+// of headers presented at connect time (login/passcode, custom Authorization bearer tokens, ...).
+type ConnectHandlerFunction func(conId string, headers map[string]string)
+
+// SubscribeHandlerFunction is invoked when a client sends a SUBSCRIBE frame.
+type SubscribeHandlerFunction func(conId string, subId string, destination string, frame *Frame)
+
+// UnsubscribeHandlerFunction is invoked when a client sends an UNSUBSCRIBE frame.
+type UnsubscribeHandlerFunction func(conId string, subId string, destination string)
+
+// ApplicationRequestHandlerFunction is invoked when a client SENDs an application request frame.
+type ApplicationRequestHandlerFunction func(destination string, payload []byte, conId string)
+
+// StompServer is the transport surface a fabricEndpoint drives. Implementations own the
+// underlying listener (TCP/WS) and the STOMP protocol handling; tests substitute a mock.
+type StompServer interface {
+    Start()
+    Stop()
+    SendMessage(destination string, messageBody []byte)
+    SendMessageToClient(conId string, destination string, messageBody []byte)
+
+    // SendMessageAfter signals that conId is resuming a durable subscription to destination
+    // from sequence fromSeq: a real implementation can use it to fence frame ordering around
+    // the replay the caller is about to send via SendMessageToClient.
+    SendMessageAfter(conId string, destination string, fromSeq uint64)
+
+    // DisconnectClient forcibly closes conId's connection, e.g. after a message rejecting a
+    // CONNECT an Authorizer refused. It is a no-op if conId is unknown or already gone.
+    DisconnectClient(conId string)
+
+    OnConnectEvent(callback ConnectHandlerFunction)
+    OnSubscribeEvent(callback SubscribeHandlerFunction)
+    OnUnsubscribeEvent(callback UnsubscribeHandlerFunction)
+    OnApplicationRequest(callback ApplicationRequestHandlerFunction)
+}